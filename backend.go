@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+// Backend is the tool used to query and configure the displays.
+type Backend interface {
+	// Name returns the name of the backend's binary.
+	Name() string
+	// CurrentSetup queries the current screen setup.
+	CurrentSetup() (display.KScreenDoctorResult, error)
+	// BuildArgs translates the desired state of the outputs into arguments
+	// for Apply.
+	BuildArgs(targetOutputs []display.Target, disabledOutputs []string) []string
+	// PowerArgs translates the power states of the target outputs into
+	// arguments for a separate Apply, run after BuildArgs' one. The other
+	// outputs stay enabled without being configured. It returns nil if
+	// there's nothing to do.
+	PowerArgs(targetOutputs []display.Target, otherOutputs []string) []string
+	// Apply invokes the backend with the given arguments.
+	Apply(args ...string) error
+	// Version returns the name and version of the backend, or an empty
+	// string if it doesn't report one.
+	Version() (string, error)
+}
+
+// backend returns the backend selected on the command line.
+func (g *Globals) backend() Backend {
+	switch g.Backend {
+	case "wlr-randr":
+		return wlrRandrBackend{globals: g}
+	default:
+		return kscreenDoctorBackend{globals: g}
+	}
+}
+
+// backendVersion returns the version of the backend, or an empty string if it
+// can't be determined, e.g. because the setup is read from a dump.
+func (g *Globals) backendVersion() string {
+	if g.KScreenJSON != "" {
+		return ""
+	}
+	version, err := g.backend().Version()
+	if err != nil {
+		g.log().Debug("failed to query backend version", "error", err)
+		return ""
+	}
+	return version
+}
+
+// compatibleVersions reports whether two backend versions are the same tool
+// with the same major version, which keeps its arguments compatible.
+func compatibleVersions(a, b string) bool {
+	toolA, versionA, _ := strings.Cut(a, " ")
+	toolB, versionB, _ := strings.Cut(b, " ")
+	majorA, _, _ := strings.Cut(versionA, ".")
+	majorB, _, _ := strings.Cut(versionB, ".")
+	return toolA == toolB && majorA == majorB
+}
+
+// lookPath finds the backend binaries and execCommand creates the commands
+// run by runCommand. They are variables, so tests can substitute fake
+// binaries without touching the PATH. The session check of kscreen-doctor is
+// skipped with IgnoreSession.
+var (
+	lookPath    = exec.LookPath
+	execCommand = exec.CommandContext
+)
+
+// runCommand runs the binary at path, killing it if it exceeds the configured
+// timeout, and returns its stdout. Errors include what it wrote to stderr.
+func (g *Globals) runCommand(path string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), g.Timeout)
+	defer cancel()
+
+	cmd := execCommand(ctx, path, args...)
+	// Don't wait for orphaned children still holding on to the output pipes.
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	g.log().Debug("running command", "command", path, "args", strings.Join(args, " "))
+	output, err := cmd.Output()
+	if stderr.Len() > 0 {
+		g.log().Debug("command printed to stderr", "command", path, "stderr", string(bytes.TrimSpace(stderr.Bytes())))
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%s %w: didn't finish within %s", path, ErrCommandFailed, g.Timeout)
+	}
+	if err != nil {
+		if message := bytes.TrimSpace(stderr.Bytes()); len(message) > 0 {
+			return nil, fmt.Errorf("%s %w: %w: %s", path, ErrCommandFailed, err, message)
+		}
+		return nil, fmt.Errorf("%s %w: %w", path, ErrCommandFailed, err)
+	}
+
+	return output, nil
+}
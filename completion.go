@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/posener/complete"
+)
+
+// profilePredictor completes the names of saved profiles. Where they are
+// kept depends on global flags, env vars and config files, so the command
+// line typed so far is parsed first.
+func profilePredictor(configPaths ...string) complete.Predictor {
+	return complete.PredictFunc(func(complete.Args) []string {
+		var cli CLI
+		parser := newParser(&cli, configPaths...)
+		parser.Stdout, parser.Stderr = io.Discard, io.Discard
+		parser.Exit = func(int) {}
+		// Incomplete command lines fail validation, but only after the flags
+		// were applied.
+		_, _ = parser.Parse(completedWords(os.Getenv("COMP_LINE")))
+		cli.useGlobals()
+
+		names, err := profileNames()
+		if err != nil {
+			return nil
+		}
+		return names
+	})
+}
+
+// completedWords returns the words of the command line being completed,
+// without the program name and the word under the cursor. The args handed to
+// predictors only start after the subcommand, so they lack global flags.
+func completedWords(line string) []string {
+	words := strings.Fields(line)
+	if len(words) > 0 && !strings.HasSuffix(line, " ") {
+		words = words[:len(words)-1]
+	}
+	if len(words) > 0 {
+		words = words[1:]
+	}
+	return words
+}
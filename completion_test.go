@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/posener/complete"
+)
+
+func TestProfilePredictor(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"pinned.json": `{"version":3,"screens":[]}`,
+		storeFile:     `{"stored":{"version":3,"screens":[]}}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(config, []byte("profile-dir = \""+dir+"\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		line        string
+		env         string
+		configPaths []string
+		want        []string
+	}{
+		{name: "flag", line: "kdedisplayprofile --profile-dir " + dir + " show ", want: []string{"pinned"}},
+		{name: "flag with value", line: "kdedisplayprofile --profile-dir=" + dir + " load pi", want: []string{"pinned"}},
+		{name: "flag after command", line: "kdedisplayprofile show --profile-dir " + dir + " ", want: []string{"pinned"}},
+		{name: "env", line: "kdedisplayprofile show ", env: dir, want: []string{"pinned"}},
+		{name: "config file", line: "kdedisplayprofile show ", configPaths: []string{config}, want: []string{"pinned"}},
+		{name: "single store", line: "kdedisplayprofile --profile-dir " + dir + " --store single show ", want: []string{"stored"}},
+		{name: "default directory", line: "kdedisplayprofile show ", want: nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("COMP_LINE", test.line)
+			t.Setenv("KDEDISPLAYPROFILE_PROFILE_DIR", test.env)
+			got := profilePredictor(test.configPaths...).Predict(complete.Args{})
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
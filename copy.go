@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type CopyProfileCmd struct {
+	Source string `arg:"1" predictor:"profile" help:"The name of the profile or a path to the profile file to copy."`
+	Dest   string `arg:"1" help:"The name of the new profile or a path to the profile file."`
+	Force  bool   `short:"f" help:"Overwrite an existing profile with the new name."`
+}
+
+func (cmd CopyProfileCmd) Run() error {
+	if inStore(cmd.Source) || inStore(cmd.Dest) {
+		return cmd.copyProfile()
+	}
+
+	sourcePath, err := profilePath(cmd.Source)
+	if err != nil {
+		return err
+	}
+	destPath, err := profilePath(cmd.Dest)
+	if err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(sourcePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, cmd.Source)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read profile: %w", err)
+	}
+	if !cmd.Force {
+		if _, err := os.Stat(destPath); err == nil {
+			return fmt.Errorf("profile %s already exists", cmd.Dest)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to access profile: %w", err)
+		}
+	}
+
+	// Copy the file as is, so hand-made formatting survives.
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	if err := writeFileAtomic(destPath, b); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+
+	return nil
+}
+
+// copyProfile copies a profile kept in the store file, or between the store
+// file and a file of its own.
+func (cmd CopyProfileCmd) copyProfile() error {
+	profile, err := readProfile(cmd.Source)
+	if err != nil {
+		return err
+	}
+	if !cmd.Force {
+		exists, err := profileExists(cmd.Dest)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("profile %s already exists", cmd.Dest)
+		}
+	}
+
+	return writeProfile(cmd.Dest, profile)
+}
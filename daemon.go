@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+type DaemonCmd struct {
+	PollInterval time.Duration `default:"5s" help:"How often to check for connected displays."`
+	DryRun       bool          `help:"Print the kscreen-doctor command instead of running it."`
+
+	RefreshTolerance float64 `default:"1.0" placeholder:"HZ" help:"Maximum deviation from the recorded refresh rate."`
+}
+
+func (cmd DaemonCmd) Run(globals *Globals) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var lastOutputs string
+	for {
+		globals.invalidateScreenSetup()
+		currentScreen, err := currentScreenSetup(globals)
+		if err != nil {
+			globals.log().Error("failed to load current screen setup", "error", err)
+		} else if outputs := outputSetKey(currentScreen); outputs != lastOutputs {
+			lastOutputs = outputs
+			cmd.reapply(globals, currentScreen)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(cmd.PollInterval):
+		}
+	}
+}
+
+// reapply loads the profile matching the connected outputs, if there is one.
+// Failures are only reported, so the daemon keeps running.
+func (cmd DaemonCmd) reapply(globals *Globals, currentScreen display.KScreenDoctorResult) {
+	name, profile, found, err := findMatchingProfile(globals, currentScreen)
+	if err != nil {
+		globals.log().Error("failed to find matching profile", "error", err)
+		return
+	}
+	if !found {
+		globals.log().Info("no profile for outputs", "outputs", outputSetKey(currentScreen))
+		return
+	}
+
+	globals.log().Info("applying profile", "profile", name)
+	err = applyProfile(globals, profile, currentScreen, loadOptions{
+		LoadOptions: display.LoadOptions{
+			RefreshTolerance: cmd.RefreshTolerance,
+		},
+	}, cmd.DryRun)
+	if err != nil {
+		globals.log().Error("failed to apply profile", "profile", name, "error", err)
+	}
+}
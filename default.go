@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+// defaultProfile is the name of the profile applied by the default command.
+const defaultProfile = "default"
+
+type DefaultCmd struct {
+	DryRun bool `help:"Print the kscreen-doctor command instead of running it."`
+	Match  bool `help:"Apply the saved profile that best matches the connected outputs if there is no ${default_profile} profile."`
+
+	RefreshTolerance float64 `default:"1.0" placeholder:"HZ" help:"Maximum deviation from the recorded refresh rate."`
+}
+
+func (cmd DefaultCmd) Run(globals *Globals) error {
+	// Meant to run from the session autostart, so a missing profile is no
+	// reason to fail. Without --match, the backend isn't needed to find out.
+	name := defaultProfile
+	profile, err := readProfile(name)
+	missing := errors.Is(err, ErrProfileNotFound)
+	if missing && !cmd.Match {
+		globals.log().Info("no default profile to apply")
+		return nil
+	}
+	if err != nil && !missing {
+		return err
+	}
+
+	currentScreen, err := currentScreenSetup(globals)
+	if err != nil {
+		return fmt.Errorf("failed to load current screen setup: %w", err)
+	}
+
+	if missing {
+		var found bool
+		name, profile, found, err = findBestProfile(globals, currentScreen)
+		if err != nil {
+			return err
+		}
+		if !found {
+			globals.log().Info("no default profile to apply")
+			return nil
+		}
+	}
+
+	globals.log().Info("applying profile", "profile", name)
+	// The default profile might reference outputs that aren't connected.
+	return applyProfile(globals, profile, currentScreen, loadOptions{
+		LoadOptions: display.LoadOptions{
+			RefreshTolerance: cmd.RefreshTolerance,
+			SkipMissing:      true,
+		},
+	}, cmd.DryRun)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+	"github.com/samber/lo"
+)
+
+// errProfileMismatch is returned by the diff command if the profile doesn't
+// match the current screen setup.
+var errProfileMismatch = errors.New("profile differs from the current screen setup")
+
+type DiffProfileCmd struct {
+	Name string `arg:"1" predictor:"profile" help:"The name of the profile or a path to the profile file."`
+
+	RefreshTolerance float64 `default:"1.0" placeholder:"HZ" help:"Maximum deviation from the recorded refresh rate."`
+}
+
+func (cmd DiffProfileCmd) Run(globals *Globals) error {
+	profile, err := readProfile(cmd.Name)
+	if err != nil {
+		return err
+	}
+
+	currentScreen, err := currentScreenSetup(globals)
+	if err != nil {
+		return fmt.Errorf("failed to load current screen setup: %w", err)
+	}
+
+	comparisons := diffProfile(profile, currentScreen, cmd.RefreshTolerance)
+	if err := printComparisons(comparisons); err != nil {
+		return err
+	}
+
+	if !allMatch(comparisons) {
+		return errProfileMismatch
+	}
+	return nil
+}
+
+// printComparisons prints the comparisons as a table, highlighting the
+// settings that don't match.
+func printComparisons(comparisons []comparison) error {
+	color := colorizer(os.Stdout)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%sOUTPUT\tSETTING\tCURRENT\tPROFILE%s\n", color(colorBold), color(colorReset))
+	for _, comparison := range comparisons {
+		rowColor := colorGreen
+		if !comparison.Matches() {
+			rowColor = colorRed
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s%s\n", color(rowColor),
+			comparison.Output, comparison.Setting, comparison.Current, comparison.Profile, color(colorReset))
+	}
+	return w.Flush()
+}
+
+// comparison holds the current and the recorded value of a single setting.
+type comparison struct {
+	Output  string
+	Setting string
+	Current string
+	Profile string
+}
+
+// Matches reports whether the current value is the one from the profile.
+func (c comparison) Matches() bool {
+	return c.Current == c.Profile
+}
+
+// allMatch reports whether all comparisons match, i.e. the profile is
+// currently applied.
+func allMatch(comparisons []comparison) bool {
+	return !slices.ContainsFunc(comparisons, func(comparison comparison) bool { return !comparison.Matches() })
+}
+
+// diffProfile compares every setting of the profile against the current
+// setup. The profile is currently applied if all comparisons match.
+func diffProfile(profile display.Profile, currentScreen display.KScreenDoctorResult, refreshTolerance float64) []comparison {
+	outputByName := lo.Associate(currentScreen.Outputs, func(output display.Output) (string, display.Output) {
+		return output.Name, output
+	})
+
+	var comparisons []comparison
+	profileOutputNames := make(map[string]bool)
+	for _, screen := range profile.Screens {
+		output, exists := display.FindOutput(currentScreen.Outputs, outputByName, screen)
+		if !screen.IsEnabled() {
+			if exists {
+				profileOutputNames[output.Name] = true
+				comparisons = append(comparisons, comparison{output.Name, "enabled", yesNo(output.Enabled), "no"})
+			}
+			continue
+		}
+		if !exists {
+			comparisons = append(comparisons, comparison{screen.Name, "connected", "no", "yes"})
+			continue
+		}
+		profileOutputNames[output.Name] = true
+
+		comparisons = append(comparisons, comparison{output.Name, "enabled", yesNo(output.Enabled), "yes"})
+		if !output.Enabled {
+			continue
+		}
+		// Loading the profile accepts any rate within the tolerance, e.g. for
+		// rates rounded when saving.
+		refreshRate := display.CurrentRefreshRate(output)
+		if math.Abs(refreshRate-screen.RefreshRate) <= refreshTolerance {
+			refreshRate = screen.RefreshRate
+		}
+		comparisons = append(comparisons,
+			comparison{output.Name, "resolution",
+				fmt.Sprintf("%dx%d", output.Size.Width, output.Size.Height),
+				fmt.Sprintf("%dx%d", screen.Size.Width, screen.Size.Height)},
+			comparison{output.Name, "position",
+				output.Pos.String(),
+				screen.Position.String()},
+			comparison{output.Name, "scale",
+				fmt.Sprintf("%g", output.Scale),
+				fmt.Sprintf("%g", screen.Scale)},
+			comparison{output.Name, "refresh rate",
+				fmt.Sprintf("%.2f Hz", refreshRate),
+				fmt.Sprintf("%.2f Hz", screen.RefreshRate)},
+		)
+		if screen.ColorProfile != "" {
+			comparisons = append(comparisons, comparison{output.Name, "color profile", output.IccProfilePath, screen.ColorProfile})
+		}
+	}
+
+	for _, output := range currentScreen.Outputs {
+		if output.Enabled && !profileOutputNames[output.Name] {
+			comparisons = append(comparisons, comparison{output.Name, "enabled", "yes", "no"})
+		}
+	}
+
+	return comparisons
+}
+
+// yesNo spells out a flag for display.
+func yesNo(flag bool) string {
+	if flag {
+		return "yes"
+	}
+	return "no"
+}
+
+// verifyOutputs describes every planned setting that didn't take effect.
+func verifyOutputs(targetOutputs []display.Target, disabledOutputs []string, appliedScreen display.KScreenDoctorResult) []string {
+	outputByName := lo.Associate(appliedScreen.Outputs, func(output display.Output) (string, display.Output) {
+		return output.Name, output
+	})
+
+	var differences []string
+	for _, target := range targetOutputs {
+		output, exists := outputByName[target.Name]
+		if !exists {
+			differences = append(differences, fmt.Sprintf("%s: missing", target.Name))
+			continue
+		}
+		if !output.Enabled {
+			differences = append(differences, fmt.Sprintf("%s: still disabled", target.Name))
+			continue
+		}
+		mode, _ := lo.Find(output.Modes, func(mode display.Mode) bool {
+			return mode.Id == output.CurrentModeId
+		})
+		if mode.Name != target.Mode {
+			differences = append(differences, fmt.Sprintf("%s: mode is %s, expected %s", target.Name, mode.Name, target.Mode))
+		}
+		if position := output.Pos.String(); position != target.Position {
+			differences = append(differences, fmt.Sprintf("%s: position is %s, expected %s", target.Name, position, target.Position))
+		}
+		if scale := display.FormatScale(output.Scale); scale != target.Scale {
+			differences = append(differences, fmt.Sprintf("%s: scale is %s, expected %s", target.Name, scale, target.Scale))
+		}
+	}
+
+	for _, name := range disabledOutputs {
+		if output, exists := outputByName[name]; exists && output.Enabled {
+			differences = append(differences, fmt.Sprintf("%s: still enabled", name))
+		}
+	}
+
+	return differences
+}
+
+// Tolerances within which two profiles are considered to describe the same
+// layout.
+const (
+	similarPositionTolerance = 10
+	similarScaleTolerance    = 0.05
+)
+
+// profilesSimilar reports whether both profiles enable the same monitors with
+// the same resolutions and roughly the same positions and scales. Monitors
+// are identified by their EDID, falling back to the connector name.
+func profilesSimilar(a, b display.Profile) bool {
+	enabledA := lo.Filter(a.Screens, func(screen display.Screen, _ int) bool { return screen.IsEnabled() })
+	enabledB := lo.Filter(b.Screens, func(screen display.Screen, _ int) bool { return screen.IsEnabled() })
+	if len(enabledA) != len(enabledB) {
+		return false
+	}
+
+	for _, screenA := range enabledA {
+		screenB, found := lo.Find(enabledB, func(screen display.Screen) bool {
+			if !screenA.Edid.IsZero() && !screen.Edid.IsZero() {
+				return screen.Edid == screenA.Edid
+			}
+			return screen.Name == screenA.Name
+		})
+		if !found || screenA.Size != screenB.Size {
+			return false
+		}
+		if math.Abs(float64(screenA.Position.X-screenB.Position.X)) > similarPositionTolerance ||
+			math.Abs(float64(screenA.Position.Y-screenB.Position.Y)) > similarPositionTolerance ||
+			math.Abs(screenA.Scale-screenB.Scale) > similarScaleTolerance {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+// Exit codes for the different kinds of failures.
+const (
+	exitFailure         = 1
+	exitProfileNotFound = 2
+	exitOutputMismatch  = 3
+	exitCommandFailed   = 4
+)
+
+var (
+	// ErrProfileNotFound is returned if a profile file doesn't exist.
+	ErrProfileNotFound = errors.New("profile not found")
+	// ErrCommandFailed is returned if kscreen-doctor (or another backend)
+	// exits unsuccessfully.
+	ErrCommandFailed = errors.New("failed")
+)
+
+// errorKind classifies an error for machine-readable output.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrProfileNotFound):
+		return "profile_not_found"
+	case errors.Is(err, display.ErrOutputMissing):
+		return "output_missing"
+	case errors.Is(err, display.ErrNoMatchingMode):
+		return "no_matching_mode"
+	case errors.Is(err, errProfileMismatch):
+		return "profile_mismatch"
+	case errors.Is(err, ErrCommandFailed):
+		return "command_failed"
+	default:
+		return "error"
+	}
+}
+
+// exitCode maps an error to the exit code reported to the caller.
+func exitCode(err error) int {
+	switch errorKind(err) {
+	case "profile_not_found":
+		return exitProfileNotFound
+	case "output_missing", "no_matching_mode", "profile_mismatch":
+		return exitOutputMismatch
+	case "command_failed":
+		return exitCommandFailed
+	default:
+		return exitFailure
+	}
+}
+
+// jsonError is the form errors are printed in with --json-errors.
+type jsonError struct {
+	Error  string `json:"error"`
+	Kind   string `json:"kind"`
+	Output string `json:"output,omitempty"`
+}
+
+// newJSONError describes the error, attributing it to the first output one
+// of its causes names.
+func newJSONError(err error) jsonError {
+	result := jsonError{
+		Error: err.Error(),
+		Kind:  errorKind(err),
+	}
+	var outputErr *display.OutputError
+	if errors.As(err, &outputErr) {
+		result.Output = outputErr.Output
+	}
+	return result
+}
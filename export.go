@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+type ExportCmd struct {
+	Name   string `arg:"1" predictor:"profile" help:"The name of the profile or a path to the profile file."`
+	Output string `short:"o" type:"path" placeholder:"FILE" help:"Write the script to the file instead of stdout."`
+
+	RefreshTolerance float64 `default:"1.0" placeholder:"HZ" help:"Maximum deviation from the recorded refresh rate."`
+	SkipMissing      bool    `help:"Skip outputs of the profile that aren't connected instead of failing."`
+}
+
+func (cmd ExportCmd) Run(globals *Globals) error {
+	profile, err := readProfile(cmd.Name)
+	if err != nil {
+		return err
+	}
+	if err := profile.CheckVersion(); err != nil {
+		return err
+	}
+
+	// The commands are planned for the outputs connected right now.
+	currentScreen, err := currentScreenSetup(globals)
+	if err != nil {
+		return fmt.Errorf("failed to load current screen setup: %w", err)
+	}
+	targetOutputs, disabledOutputs, err := display.Load(profile, currentScreen, display.LoadOptions{
+		RefreshTolerance: cmd.RefreshTolerance,
+		SkipMissing:      cmd.SkipMissing,
+		Logger:           globals.log(),
+	})
+	if err != nil {
+		return err
+	}
+
+	backend := globals.backend()
+	powerArgs, err := buildPowerArgs(globals, backend, targetOutputs, disabledOutputs)
+	if err != nil {
+		return err
+	}
+
+	var script strings.Builder
+	fmt.Fprintln(&script, "#!/bin/sh")
+	fmt.Fprintf(&script, "# Applies the display profile %s, exported by kdedisplayprofile.\n", cmd.Name)
+	fmt.Fprintln(&script, "set -e")
+	if profile.PreApply != "" {
+		fmt.Fprintln(&script, profile.PreApply)
+	}
+	fmt.Fprintln(&script, shellCommand(backend.Name(), backend.BuildArgs(targetOutputs, disabledOutputs)...))
+	if len(powerArgs) > 0 {
+		fmt.Fprintln(&script, shellCommand(backend.Name(), powerArgs...))
+	}
+	if profile.PostApply != "" {
+		fmt.Fprintln(&script, profile.PostApply)
+	}
+
+	if cmd.Output == "" {
+		fmt.Print(script.String())
+		return nil
+	}
+	if err := os.WriteFile(cmd.Output, []byte(script.String()), 0755); err != nil {
+		return fmt.Errorf("failed to write script: %w", err)
+	}
+	return nil
+}
+
+// safeShellWord matches words that don't need quoting in a shell script.
+var safeShellWord = regexp.MustCompile(`^[A-Za-z0-9_./,:@%+=-]+$`)
+
+// shellCommand joins the command and its arguments into a line of shell
+// script, quoting arguments where necessary.
+func shellCommand(name string, args ...string) string {
+	words := []string{name}
+	for _, arg := range args {
+		if !safeShellWord.MatchString(arg) {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
+}
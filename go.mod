@@ -4,7 +4,25 @@ go 1.22.2
 
 require (
 	github.com/alecthomas/kong v0.9.0
+	github.com/alecthomas/kong-toml v0.2.0
+	github.com/invopop/jsonschema v0.13.0
+	github.com/posener/complete v1.2.3
 	github.com/samber/lo v1.39.0
+	github.com/willabides/kongplete v0.4.0
+	golang.org/x/sync v0.10.0
+	golang.org/x/term v0.27.0
 )
 
-require golang.org/x/exp v0.0.0-20220303212507-bbda1eaf7a17 // indirect
+require (
+	github.com/bahlo/generic-list-go v0.2.0 // indirect
+	github.com/buger/jsonparser v1.1.1 // indirect
+	github.com/hashicorp/errwrap v1.1.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/mailru/easyjson v0.7.7 // indirect
+	github.com/pelletier/go-toml v1.9.5 // indirect
+	github.com/riywo/loginshell v0.0.0-20200815045211-7d26008be1ab // indirect
+	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
+	golang.org/x/exp v0.0.0-20220303212507-bbda1eaf7a17 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+// kscreenDoctorBackend configures the displays of a KDE Plasma session using
+// kscreen-doctor.
+type kscreenDoctorBackend struct {
+	globals *Globals
+}
+
+func (b kscreenDoctorBackend) Name() string {
+	return "kscreen-doctor"
+}
+
+// path returns the configured kscreen-doctor binary, or the one found in
+// PATH.
+func (b kscreenDoctorBackend) path() (string, error) {
+	name := "kscreen-doctor"
+	if b.globals.KScreenDoctor != "" {
+		name = b.globals.KScreenDoctor
+	}
+	path, err := lookPath(name)
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		if b.globals.KScreenDoctor != "" {
+			return "", fmt.Errorf("kscreen-doctor not found at %s", b.globals.KScreenDoctor)
+		}
+		return "", errors.New("kscreen-doctor not found in PATH, install the package providing it (libkscreen or plasma-workspace, depending on the distribution) or use --kscreen-doctor to specify its location")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find kscreen-doctor: %w", err)
+	}
+	return path, nil
+}
+
+// checkSession makes sure a graphical Plasma session is running, as
+// kscreen-doctor can't reach KScreen otherwise.
+func (b kscreenDoctorBackend) checkSession() error {
+	if b.globals.IgnoreSession {
+		return nil
+	}
+	if os.Getenv("XDG_SESSION_TYPE") == "tty" || (os.Getenv("WAYLAND_DISPLAY") == "" && os.Getenv("DISPLAY") == "") {
+		return errors.New("no graphical session found, kscreen-doctor needs a running Wayland or X11 Plasma session (use --ignore-session to try anyway)")
+	}
+	desktop := os.Getenv("XDG_CURRENT_DESKTOP")
+	if desktop != "" && !slices.Contains(strings.Split(desktop, ":"), "KDE") {
+		return fmt.Errorf("not running in a KDE Plasma session but %s, kscreen-doctor only works with KScreen (use --ignore-session to try anyway)", desktop)
+	}
+	return nil
+}
+
+func (b kscreenDoctorBackend) CurrentSetup() (display.KScreenDoctorResult, error) {
+	if err := b.checkSession(); err != nil {
+		return display.KScreenDoctorResult{}, err
+	}
+	path, err := b.path()
+	if err != nil {
+		return display.KScreenDoctorResult{}, err
+	}
+	return display.Current(func(args ...string) ([]byte, error) {
+		return b.globals.runCommand(path, args...)
+	})
+}
+
+func (b kscreenDoctorBackend) BuildArgs(targetOutputs []display.Target, disabledOutputs []string) []string {
+	return display.KScreenDoctorArgs(targetOutputs, disabledOutputs)
+}
+
+func (b kscreenDoctorBackend) PowerArgs(targetOutputs []display.Target, otherOutputs []string) []string {
+	return display.KScreenDoctorDpmsArgs(targetOutputs, otherOutputs)
+}
+
+func (b kscreenDoctorBackend) Apply(args ...string) error {
+	if err := b.checkSession(); err != nil {
+		return err
+	}
+	path, err := b.path()
+	if err != nil {
+		return err
+	}
+	output, err := b.globals.runCommand(path, args...)
+	if len(output) > 0 {
+		b.globals.log().Debug("command output", "command", path, "output", string(bytes.TrimSpace(output)))
+	}
+	return err
+}
+
+func (b kscreenDoctorBackend) Version() (string, error) {
+	path, err := b.path()
+	if err != nil {
+		return "", err
+	}
+	output, err := b.globals.runCommand(path, "--version")
+	if err != nil {
+		return "", err
+	}
+	// Prints e.g. "kscreen-doctor 6.1.0".
+	version, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSpace(version), nil
+}
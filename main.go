@@ -1,238 +1,1244 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"math"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"text/tabwriter"
+	"text/template"
+	"time"
+	"unicode"
 
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
 	"github.com/alecthomas/kong"
+	kongtoml "github.com/alecthomas/kong-toml"
 	"github.com/samber/lo"
+	"github.com/willabides/kongplete"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/term"
 )
 
-type Output struct {
-	Name          string   `json:"name"`
-	CurrentModeId string   `json:"currentModeId"`
-	Enabled       bool     `json:"enabled"`
-	Size          Size     `json:"size"`
-	Pos           Position `json:"pos"`
-	Scale         float64  `json:"scale"`
-	Modes         []Mode   `json:"modes"`
-	Priority      int      `json:"priority"`
+type SaveProfileCmd struct {
+	Name     string `arg:"1" optional:"1" help:"The name of the profile or a path to the profile file. Derived from the connected outputs if omitted."`
+	AutoName bool   `help:"Derive the profile name from the connected outputs, e.g. laptop+DP-1."`
+	Relative bool   `help:"Store positions relative to the primary output, so they adapt to changes of its resolution."`
+	Strict   bool   `help:"Fail if the refresh rate of an output can't be determined instead of recording it as 0."`
+	Force    bool   `short:"f" help:"Overwrite an existing profile with the derived name."`
+
+	RefreshPrecision int `default:"-1" placeholder:"DIGITS" help:"Round refresh rates to this many decimal places, e.g. 0 for whole Hz. Negative values keep them as reported."`
+
+	NoClobber bool `xor:"existing" help:"Fail if the profile already exists."`
+	Update    bool `xor:"existing" help:"Only replace the screens of connected outputs in an existing profile, keeping the others."`
+
+	Tags []string `name:"tag" placeholder:"TAG" help:"Tag the profile, e.g. home or docked. Can be repeated. Keeps the tags of an overwritten profile if omitted."`
 }
 
-type Mode struct {
-	Id          string  `json:"id"`
-	Name        string  `json:"name"`
-	RefreshRate float64 `json:"refreshRate"`
-	Size        Size    `json:"size"`
+type LoadProfileCmd struct {
+	Name        string `arg:"1" optional:"1" predictor:"profile" help:"The name of the profile, a path to the profile file, an http(s) URL or - to read it from stdin. Pick one interactively if omitted."`
+	DryRun      bool   `help:"Print the kscreen-doctor command instead of running it."`
+	Interactive bool   `short:"i" help:"Pick the profile from a list of saved profiles."`
+	Confirm     bool   `help:"Show how the profile differs from the current setup and ask before applying it."`
+
+	RefreshTolerance float64 `default:"1.0" placeholder:"HZ" help:"Maximum deviation from the recorded refresh rate."`
+	SkipMissing      bool    `help:"Skip outputs of the profile that aren't connected instead of failing."`
+	LeaveUnlisted    bool    `help:"Only touch outputs listed in the profile instead of disabling all others."`
+	Realign          bool    `help:"Recompute positions to keep outputs edge-aligned if their applied size differs from the profile."`
+	NoBackup         bool    `help:"Don't save the current setup as profile ${backup_profile} before loading."`
+	Verify           bool    `help:"Check that the backend actually applied the profile."`
+	Retries          int     `placeholder:"N" help:"Retry applying up to N times with increasing delays, e.g. while the compositor settles after a hotplug."`
+	IntegerScale     bool    `help:"Round fractional scales to the nearest integer."`
+	AllowGaps        bool    `help:"Don't warn about outputs that don't touch the rest of the layout."`
+	BestFit          bool    `help:"Use the closest available resolution, preferring the same aspect ratio, if an output doesn't support the recorded one."`
+	CheckDPI         bool    `name:"check-dpi" help:"Warn about scales resulting in an unusual effective DPI on the connected monitors."`
+
+	ForceBlackout bool `help:"Apply the profile even if it leaves no output enabled."`
+
+	Remap map[string]string `placeholder:"OLD=NEW" help:"Treat output OLD of the profile as output NEW, e.g. after a monitor moved to another port. Can be repeated."`
+	Only  []string          `placeholder:"NAME" help:"Only apply the profile's settings for the output and leave all others untouched. Can be repeated."`
+
+	WaitForOutput []string      `placeholder:"NAME" help:"Wait until the output is connected before loading, e.g. during boot. Can be repeated."`
+	WaitTimeout   time.Duration `default:"30s" help:"Maximum time to wait for the outputs given by --wait-for-output."`
+
+	FetchTimeout time.Duration `default:"10s" help:"Maximum time fetching a profile from a URL may take."`
+
+	Disable []string `placeholder:"PATTERN" help:"Disable outputs not in the profile matching the pattern, e.g. 'HDMI-*', even with --leave-unlisted. Can be repeated."`
+	Keep    []string `placeholder:"PATTERN" help:"Never disable outputs matching the pattern, e.g. 'eDP-1'. Can be repeated."`
 }
 
-type Size struct {
-	Height int `json:"height"`
-	Width  int `json:"width"`
+type ListProfilesCmd struct {
+	JSON   bool     `name:"json" xor:"format" help:"Print the profiles as JSON."`
+	Format string   `xor:"format" placeholder:"TEMPLATE" help:"Print each profile using a Go template, e.g. '{{.Name}}'."`
+	Tags   []string `name:"tag" placeholder:"TAG" help:"Only list profiles with this tag. Can be repeated to require several tags."`
 }
 
-type Position struct {
-	X int `json:"x"`
-	Y int `json:"y"`
+type DeleteProfileCmd struct {
+	Name  string `arg:"1" predictor:"profile" help:"The name of the profile or a path to the profile file."`
+	Force bool   `short:"f" help:"Don't ask for confirmation and ignore missing profiles."`
 }
 
-type KScreenDoctorResult struct {
-	Outputs []Output `json:"outputs"`
+// Globals holds the flags shared by all commands.
+type Globals struct {
+	Verbose       bool          `short:"v" help:"Log the backend invocations and their output, same as --log-level=debug."`
+	Backend       string        `enum:"kscreen-doctor,wlr-randr" default:"kscreen-doctor" help:"The tool used to query and configure the displays (${enum})."`
+	KScreenDoctor string        `name:"kscreen-doctor" env:"KDEDISPLAYPROFILE_KSCREEN_DOCTOR" placeholder:"PATH" help:"Path to the kscreen-doctor binary."`
+	Timeout       time.Duration `default:"10s" help:"Maximum time a backend invocation may take."`
+	Quiet         bool          `short:"q" help:"Only print errors, same as --log-level=error."`
+	JSONErrors    bool          `name:"json-errors" help:"Print errors as JSON objects to stdout."`
+	ProfileDir    string        `type:"path" env:"KDEDISPLAYPROFILE_PROFILE_DIR" placeholder:"DIR" help:"Directory profiles are stored in, instead of $XDG_CONFIG_HOME/kdedisplayprofile."`
+	KScreenJSON   string        `name:"kscreen-json" placeholder:"FILE" help:"Read the current setup from a kscreen-doctor --json dump instead (- for stdin)."`
+	Store         string        `enum:"files,single" default:"files" help:"Keep each profile in a file of its own, or all of them in a single ${store_file} (${enum})."`
+	LogLevel      string        `enum:"debug,info,warn,error" default:"info" help:"Minimum level of logged messages (${enum})."`
+	LogFormat     string        `enum:"text,json" default:"text" help:"Format of logged messages (${enum})."`
+	Timings       bool          `help:"Print how long querying and configuring the displays took."`
+	IgnoreSession bool          `help:"Run kscreen-doctor even outside of a graphical Plasma session."`
+	StrictJSON    bool          `name:"strict-json" help:"Fail on unknown fields in profiles, e.g. misspelled settings, instead of ignoring them."`
+
+	// setup caches the current screen setup until it is changed.
+	setup *display.KScreenDoctorResult
+	// logger is created on first use by log, which loggerOnce guards as
+	// commands may log from several goroutines.
+	logger     *slog.Logger
+	loggerOnce sync.Once
+	// timings collects the durations of the steps measured so far.
+	timings []timing
 }
 
-type Profile struct {
-	Screens []Screen `json:"screens"`
+// timing is the duration of a single step, e.g. applying a profile.
+type timing struct {
+	step     string
+	duration time.Duration
 }
 
-type Screen struct {
-	Name        string   `json:"name"`
-	Size        Size     `json:"size"`
-	Position    Position `json:"position"`
-	RefreshRate float64  `json:"refreshRate"`
-	Scale       float64  `json:"scale"`
+// measure starts timing the step and returns the function ending it.
+func (g *Globals) measure(step string) func() {
+	start := time.Now()
+	return func() {
+		duration := time.Since(start)
+		g.timings = append(g.timings, timing{step: step, duration: duration})
+		g.log().Debug("finished step", "step", step, "duration", duration)
+	}
 }
 
-type SaveProfileCmd struct {
-	Name string `arg:"1" help:"The name of the profile."`
+// printTimings prints the measured steps to stderr.
+func (g *Globals) printTimings() {
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	var total time.Duration
+	for _, timing := range g.timings {
+		fmt.Fprintf(w, "%s\t%s\n", timing.step, timing.duration.Round(time.Millisecond))
+		total += timing.duration
+	}
+	fmt.Fprintf(w, "total\t%s\n", total.Round(time.Millisecond))
+	_ = w.Flush()
 }
 
-type LoadProfileCmd struct {
-	Name string `arg:"1" help:"The name of the profile."`
+// log returns the logger writing to stderr. --verbose and --quiet are
+// shortcuts for the debug and error log levels.
+func (g *Globals) log() *slog.Logger {
+	g.loggerOnce.Do(func() {
+		level := slog.LevelInfo
+		_ = level.UnmarshalText([]byte(g.LogLevel))
+		if g.Verbose {
+			level = slog.LevelDebug
+		}
+		if g.Quiet {
+			level = slog.LevelError
+		}
+
+		opts := &slog.HandlerOptions{Level: level}
+		var handler slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+		if g.LogFormat == "json" {
+			handler = slog.NewJSONHandler(os.Stderr, opts)
+		}
+		g.logger = slog.New(handler)
+	})
+	return g.logger
+}
+
+type ShowProfileCmd struct {
+	Name   string `arg:"1" predictor:"profile" help:"The name of the profile or a path to the profile file."`
+	JSON   bool   `name:"json" xor:"format" help:"Print the profile as JSON."`
+	Format string `xor:"format" placeholder:"TEMPLATE" help:"Print the profile using a Go template, e.g. '{{range .Screens}}{{.Name}} {{end}}'."`
+}
+
+type CurrentCmd struct {
+	JSON bool `name:"json" help:"Print the profile as JSON."`
+}
+
+type ApplyCmd struct {
+	Outputs []string `name:"output" sep:"none" required:"" placeholder:"SPEC" help:"Output settings like name=DP-1,mode=1920x1080@60,pos=0,0,scale=1. Can be repeated."`
+	Disable []string `placeholder:"NAME" help:"Outputs to disable."`
+	DryRun  bool     `help:"Print the kscreen-doctor command instead of running it."`
 }
 
 type CLI struct {
-	Save SaveProfileCmd `cmd:"1" help:"Save the current profile to a file."`
-	Load LoadProfileCmd `cmd:"1" help:"Load the profile from a file."`
+	Globals
+
+	Save     SaveProfileCmd   `cmd:"1" help:"Save the current profile."`
+	Load     LoadProfileCmd   `cmd:"1" help:"Load a saved profile."`
+	List     ListProfilesCmd  `cmd:"1" help:"List the saved profiles."`
+	Delete   DeleteProfileCmd `cmd:"1" help:"Delete a saved profile."`
+	Show     ShowProfileCmd   `cmd:"1" help:"Show the contents of a saved profile."`
+	Current  CurrentCmd       `cmd:"1" help:"Show the profile for the current screen setup without saving it."`
+	Apply    ApplyCmd         `cmd:"1" help:"Apply output settings without a profile."`
+	Scale    ScaleCmd         `cmd:"1" help:"Set the same scale on all enabled outputs, keeping their modes and positions."`
+	Diff     DiffProfileCmd   `cmd:"1" help:"Compare a saved profile against the current screen setup."`
+	Rename   RenameProfileCmd `cmd:"1" help:"Rename a saved profile."`
+	Copy     CopyProfileCmd   `cmd:"1" help:"Copy a saved profile."`
+	Merge    MergeCmd         `cmd:"1" help:"Combine several saved profiles into a new one."`
+	Export   ExportCmd        `cmd:"1" help:"Write a shell script applying a saved profile without kdedisplayprofile."`
+	Set      SetCmd           `cmd:"1" help:"Change a setting of an output in a saved profile."`
+	Validate ValidateCmd      `cmd:"1" help:"Check whether a profile can be applied to the current screen setup."`
+	Daemon   DaemonCmd        `cmd:"1" help:"Watch for connected displays and apply the matching profile."`
+	Match    MatchCmd         `cmd:"1" help:"Apply the saved profile that best matches the connected outputs."`
+	Undo     UndoCmd          `cmd:"1" help:"Restore the setup from before the last load."`
+	Status   StatusCmd        `cmd:"1" help:"Print the name of the saved profile matching the current setup, e.g. for status bars."`
+	Default  DefaultCmd       `cmd:"1" help:"Apply the ${default_profile} profile if it exists, e.g. from the session autostart."`
+	Schema   SchemaCmd        `cmd:"1" help:"Print a JSON Schema describing profile files, e.g. for editor completion."`
+
+	InstallCompletions kongplete.InstallCompletions `cmd:"1" help:"Install shell completions for bash, zsh or fish."`
 }
 
-func (cmd SaveProfileCmd) Run() error {
-	result, err := currentScreenSetup()
+func (cmd SaveProfileCmd) Run(globals *Globals) error {
+	if cmd.AutoName && cmd.Name != "" {
+		return errors.New("--auto-name can't be combined with an explicit profile name")
+	}
+
+	result, err := currentScreenSetup(globals)
 	if err != nil {
 		return fmt.Errorf("failed to load current screen setup: %w", err)
 	}
 
-	// Sort by priority.
-	slices.SortFunc(result.Outputs, func(a, b Output) int {
-		return a.Priority - b.Priority
+	profile, err := display.Save(result, display.SaveOptions{
+		Strict: cmd.Strict,
+		Logger: globals.log(),
 	})
+	if err != nil {
+		return err
+	}
+	if cmd.Relative {
+		display.MakePositionsRelative(profile.Screens)
+	}
+	if cmd.RefreshPrecision >= 0 {
+		factor := math.Pow10(cmd.RefreshPrecision)
+		for i := range profile.Screens {
+			profile.Screens[i].RefreshRate = math.Round(profile.Screens[i].RefreshRate*factor) / factor
+		}
+	}
+	profile.BackendVersion = globals.backendVersion()
+	profile.Tags = cmd.Tags
 
-	var profile Profile
-	for _, output := range result.Outputs {
-		if !output.Enabled {
-			continue
+	name := cmd.Name
+	autoNamed := name == ""
+	if autoNamed {
+		name = autoProfileName(result)
+	}
+
+	if cmd.NoClobber {
+		exists, err := profileExists(name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("profile %s already exists", name)
 		}
+	}
 
-		var screen Screen
-		screen.Name = output.Name
-		screen.Size = output.Size
-		screen.Position = output.Pos
-		screen.Scale = output.Scale
+	// Hooks can't be derived from the current setup, so keep the ones of the
+	// profile being overwritten.
+	if existing, err := readProfile(name); err == nil {
+		profile.PreApply = existing.PreApply
+		profile.PostApply = existing.PostApply
+		if len(profile.Tags) == 0 {
+			profile.Tags = existing.Tags
+		}
+		if cmd.Update {
+			// Only connected outputs are part of the new profile, so
+			// screens of outputs that are absent now survive.
+			updated := mergeProfiles(existing, profile)
+			updated.Version = profile.Version
+			updated.BackendVersion = profile.BackendVersion
+			profile = updated
+		}
+	} else if !errors.Is(err, ErrProfileNotFound) && cmd.Update {
+		return err
+	}
 
-		for _, mode := range output.Modes {
-			if mode.Id == output.CurrentModeId {
-				screen.RefreshRate = mode.RefreshRate
-				break
-			}
+	if autoNamed {
+		exists, err := profileExists(name)
+		if err != nil {
+			return err
 		}
+		if exists && !cmd.Force {
+			return fmt.Errorf("profile %s already exists, use --force to overwrite it", name)
+		}
+		if !globals.Quiet {
+			fmt.Println(name)
+		}
+	}
 
-		if screen.RefreshRate == 0 {
-			return fmt.Errorf("failed to determine refreshrate for output %s", output.Name)
+	warnSimilarProfiles(globals, name, profile)
+
+	return writeProfile(name, profile)
+}
+
+// warnSimilarProfiles points out saved profiles describing the same layout,
+// so near-duplicates don't pile up.
+func warnSimilarProfiles(globals *Globals, name string, profile display.Profile) {
+	names, err := profileNames()
+	if err != nil {
+		return
+	}
+	for _, other := range names {
+		if other == name {
+			continue
+		}
+		if existing, err := readProfile(other); err == nil && profilesSimilar(profile, existing) {
+			globals.log().Warn("this layout looks like an existing profile", "profile", other)
 		}
+	}
+}
 
-		profile.Screens = append(profile.Screens, screen)
+// writeProfile stores the profile under the given name or path.
+func writeProfile(name string, profile display.Profile) error {
+	if inStore(name) {
+		profiles, err := readStore()
+		if err != nil {
+			return err
+		}
+		profiles[name] = profile
+		return writeStore(profiles)
 	}
 
-	b, err := json.Marshal(profile)
+	b, err := json.MarshalIndent(profile, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to serialize profile: %w", err)
 	}
-	if err := os.WriteFile(cmd.Name, b, 0644); err != nil {
+	b = append(b, '\n')
+
+	path, err := profilePath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	if err := writeFileAtomic(path, b); err != nil {
 		return fmt.Errorf("failed to write profile: %w", err)
 	}
 
 	return nil
 }
 
-func (cmd LoadProfileCmd) Run() error {
-	b, err := os.ReadFile(cmd.Name)
+// backupProfile is the name the setup is saved under before loading a profile.
+const backupProfile = ".last"
+
+// backupSetup saves the given setup as the backup profile.
+func backupSetup(globals *Globals, currentScreen display.KScreenDoctorResult) error {
+	profile, err := display.Save(currentScreen, display.SaveOptions{Logger: globals.log()})
 	if err != nil {
-		return fmt.Errorf("failed to read profile: %w", err)
+		return err
 	}
-	var profile Profile
-	if err := json.Unmarshal(b, &profile); err != nil {
-		return fmt.Errorf("failed to deserialize profile: %w", err)
+	if err := writeProfile(backupProfile, profile); err != nil {
+		return fmt.Errorf("failed to back up current setup: %w", err)
+	}
+	return nil
+}
+
+func (cmd LoadProfileCmd) Run(globals *Globals) error {
+	if cmd.Name == "" || cmd.Interactive {
+		name, err := pickProfile()
+		if err != nil {
+			return err
+		}
+		cmd.Name = name
 	}
 
-	currentScreen, err := currentScreenSetup()
+	name, err := resolveProfileName(cmd.Name)
 	if err != nil {
-		return fmt.Errorf("failed to load current screen setup: %w", err)
+		return err
 	}
+	cmd.Name = name
 
-	outputByName := lo.Associate(currentScreen.Outputs, func(output Output) (string, Output) {
-		return output.Name, output
+	// Waiting for outputs may take a while, so read the profile meanwhile.
+	var profile display.Profile
+	var currentScreen display.KScreenDoctorResult
+	// The goroutines must not touch globals, except through the setup
+	// query, which only one of them runs.
+	logger := globals.log()
+	g, ctx := errgroup.WithContext(context.Background())
+	g.Go(func() error {
+		var err error
+		if isProfileURL(cmd.Name) {
+			profile, err = fetchProfile(ctx, logger, cmd.Name, cmd.FetchTimeout)
+		} else {
+			profile, err = readProfile(cmd.Name)
+		}
+		return err
 	})
+	g.Go(func() error {
+		var err error
+		currentScreen, err = waitForOutputs(ctx, globals, cmd.WaitForOutput, cmd.WaitTimeout)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		return err
+	}
 
-	type targetOutputProperties struct {
-		name     string
-		mode     string
-		position string
-		scale    string
-	}
-	var targetOutputs []targetOutputProperties
-	var targetOutputNames = make(map[string]bool)
-	for _, desiredScreen := range profile.Screens {
-		var targetOutput targetOutputProperties
-		targetOutput.name = desiredScreen.Name
-		targetOutput.scale = fmt.Sprintf("%f", desiredScreen.Scale)
-		targetOutput.position = fmt.Sprintf("%d,%d", desiredScreen.Position.X, desiredScreen.Position.Y)
-
-		output, exists := outputByName[desiredScreen.Name]
-		if !exists {
-			return fmt.Errorf("profile references missing output %s", desiredScreen.Name)
+	if cmd.Confirm && !cmd.DryRun {
+		if !isTerminal(os.Stdin) {
+			return errors.New("--confirm needs a terminal to ask for confirmation")
+		}
+		if err := printComparisons(diffProfile(profile, currentScreen, cmd.RefreshTolerance)); err != nil {
+			return err
+		}
+		ok, err := confirm(fmt.Sprintf("Apply profile %s?", cmd.Name))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+
+	if !cmd.NoBackup && !cmd.DryRun {
+		if err := backupSetup(globals, currentScreen); err != nil {
+			return err
+		}
+	}
+
+	for _, pattern := range append(slices.Clone(cmd.Disable), cmd.Keep...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid output pattern %q: %w", pattern, err)
+		}
+	}
+
+	opts := loadOptions{
+		LoadOptions: display.LoadOptions{
+			RefreshTolerance: cmd.RefreshTolerance,
+			SkipMissing:      cmd.SkipMissing,
+			LeaveUnlisted:    cmd.LeaveUnlisted,
+			Realign:          cmd.Realign,
+			IntegerScale:     cmd.IntegerScale,
+			DisablePatterns:  cmd.Disable,
+			KeepPatterns:     cmd.Keep,
+			AllowGaps:        cmd.AllowGaps,
+			Only:             cmd.Only,
+			Remap:            cmd.Remap,
+			AllowBlackout:    cmd.ForceBlackout,
+			CheckDPI:         cmd.CheckDPI,
+			BestFit:          cmd.BestFit,
+		},
+		verify: cmd.Verify,
+	}
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err = applyProfile(globals, profile, currentScreen, opts, cmd.DryRun)
+		if err == nil && !cmd.DryRun {
+			globals.log().Info("applied profile", "profile", cmd.Name)
+		}
+		if errors.Is(err, display.ErrNoOutputEnabled) {
+			return fmt.Errorf("%w, use --force-blackout to apply it anyway", err)
+		}
+		if err == nil || attempt >= cmd.Retries || cmd.DryRun || !isTransient(err) {
+			return err
+		}
+
+		globals.log().Warn("applying failed, retrying", "delay", delay, "error", err)
+		time.Sleep(delay)
+		delay *= 2
+
+		// Outputs might still be initializing, so the available modes can
+		// change between attempts.
+		globals.invalidateScreenSetup()
+		currentScreen, err = currentScreenSetup(globals)
+		if err != nil {
+			return fmt.Errorf("failed to load current screen setup: %w", err)
+		}
+	}
+}
+
+// retryDelay is the delay before the first retry of a failed load.
+const retryDelay = 500 * time.Millisecond
+
+// isTransient reports whether retrying might resolve the error, because it
+// was caused by outputs that haven't settled yet.
+func isTransient(err error) bool {
+	return errors.Is(err, ErrCommandFailed) ||
+		errors.Is(err, display.ErrOutputMissing) ||
+		errors.Is(err, display.ErrNoMatchingMode) ||
+		errors.Is(err, errProfileMismatch)
+}
+
+// outputPollInterval is how often waitForOutputs checks the screen setup.
+const outputPollInterval = 500 * time.Millisecond
+
+// waitForOutputs polls the screen setup until all the named outputs are
+// connected, the timeout expires or ctx is canceled, and returns the last
+// setup queried.
+func waitForOutputs(ctx context.Context, globals *Globals, names []string, timeout time.Duration) (display.KScreenDoctorResult, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		currentScreen, err := currentScreenSetup(globals)
+		if err != nil {
+			return display.KScreenDoctorResult{}, fmt.Errorf("failed to load current screen setup: %w", err)
 		}
 
-		potentialModes := lo.Filter(output.Modes, func(mode Mode, _ int) bool {
-			return mode.Size == desiredScreen.Size
+		connected := lo.Map(connectedOutputs(currentScreen), func(output display.Output, _ int) string {
+			return output.Name
 		})
-		if len(potentialModes) == 0 {
-			return fmt.Errorf("output %s doesn't contain a matching mode", desiredScreen.Name)
+		missing, _ := lo.Difference(names, connected)
+		if len(missing) == 0 {
+			return currentScreen, nil
+		}
+		if time.Now().After(deadline) {
+			return display.KScreenDoctorResult{}, fmt.Errorf("%w %s after waiting %s", display.ErrOutputMissing, strings.Join(missing, ", "), timeout)
+		}
+
+		globals.log().Debug("waiting for outputs", "outputs", strings.Join(missing, ", "))
+		select {
+		case <-ctx.Done():
+			return display.KScreenDoctorResult{}, ctx.Err()
+		case <-time.After(outputPollInterval):
+		}
+		globals.invalidateScreenSetup()
+	}
+}
+
+// loadOptions controls how a profile is applied.
+type loadOptions struct {
+	display.LoadOptions
+	// verify checks the setup again after applying the profile.
+	verify bool
+}
+
+// applyProfile maps the profile onto the current setup and applies it.
+func applyProfile(globals *Globals, profile display.Profile, currentScreen display.KScreenDoctorResult, opts loadOptions, dryRun bool) error {
+	if err := profile.CheckVersion(); err != nil {
+		return err
+	}
+
+	if profile.BackendVersion != "" {
+		if version := globals.backendVersion(); version != "" && !compatibleVersions(profile.BackendVersion, version) {
+			globals.log().Warn("profile was saved with a different backend version, its arguments might not be understood",
+				"saved", profile.BackendVersion, "running", version)
+		}
+	}
+
+	opts.Logger = globals.log()
+	targetOutputs, disabledOutputs, err := display.Load(profile, currentScreen, opts.LoadOptions)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		// Print the hooks as well, so the output stays a runnable script.
+		if profile.PreApply != "" {
+			fmt.Println(profile.PreApply)
+		}
+		if err := applyOutputs(globals, targetOutputs, disabledOutputs, true); err != nil {
+			return err
+		}
+		if profile.PostApply != "" {
+			fmt.Println(profile.PostApply)
 		}
-		// Pick the mode with the next best refreshrate
-		slices.SortFunc(potentialModes, func(a, b Mode) int {
-			diffA := math.Abs(desiredScreen.RefreshRate - a.RefreshRate)
-			diffB := math.Abs(desiredScreen.RefreshRate - b.RefreshRate)
+		return nil
+	}
+
+	if err := runHook(globals, "pre-apply", profile.PreApply); err != nil {
+		return err
+	}
+	if err := applyOutputs(globals, targetOutputs, disabledOutputs, false); err != nil {
+		return err
+	}
+	if err := runHook(globals, "post-apply", profile.PostApply); err != nil {
+		return err
+	}
+
+	if opts.verify {
+		appliedScreen, err := currentScreenSetup(globals)
+		if err != nil {
+			return fmt.Errorf("failed to load applied screen setup: %w", err)
+		}
+		if differences := verifyOutputs(targetOutputs, disabledOutputs, appliedScreen); len(differences) > 0 {
+			return fmt.Errorf("%w after applying:\n%s", errProfileMismatch, strings.Join(differences, "\n"))
+		}
+	}
+	return nil
+}
 
-			return int(diffA - diffB)
+// runHook runs a profile hook using the shell. Empty hooks are skipped.
+func runHook(globals *Globals, name, hook string) error {
+	if hook == "" {
+		return nil
+	}
+
+	globals.log().Debug("running hook", "hook", name, "command", hook)
+	cmd := exec.Command("sh", "-c", hook)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %w", name, err)
+	}
+	return nil
+}
+
+func (cmd ListProfilesCmd) Run(globals *Globals) error {
+	names, err := profileNames()
+	if err != nil {
+		return err
+	}
+
+	profiles := []namedProfile{}
+	for _, name := range names {
+		profile, err := readProfile(name)
+		if err != nil {
+			globals.log().Warn("skipping profile", "profile", name, "error", err)
+			continue
+		}
+		if !hasTags(profile, cmd.Tags) {
+			continue
+		}
+
+		profiles = append(profiles, namedProfile{
+			Name:    name,
+			Profile: profile,
 		})
-		targetOutput.mode = potentialModes[0].Name
+	}
 
-		targetOutputs = append(targetOutputs, targetOutput)
-		targetOutputNames[targetOutput.name] = true
+	if cmd.JSON {
+		return json.NewEncoder(os.Stdout).Encode(profiles)
+	}
+	if cmd.Format != "" {
+		return printTemplate(cmd.Format, profiles...)
 	}
 
-	var disabledOutputs []string
-	for outputName := range outputByName {
-		if !targetOutputNames[outputName] {
-			disabledOutputs = append(disabledOutputs, outputName)
+	for _, profile := range profiles {
+		fmt.Println(profile.Name)
+		for _, screen := range profile.Screens {
+			if !screen.IsEnabled() {
+				fmt.Printf("  %s: disabled\n", screen.Label())
+				continue
+			}
+			fmt.Printf("  %s: %dx%d @ %.2f Hz\n", screen.Label(), screen.Size.Width, screen.Size.Height, screen.RefreshRate)
 		}
 	}
 
-	var args []string
-	for _, outputName := range disabledOutputs {
-		args = append(args, fmt.Sprintf("output.%s.disable", outputName))
+	return nil
+}
+
+// hasTags reports whether the profile carries all of the tags.
+func hasTags(profile display.Profile, tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(profile.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cmd ShowProfileCmd) Run() error {
+	name, err := resolveProfileName(cmd.Name)
+	if err != nil {
+		return err
 	}
-	for _, output := range targetOutputs {
-		args = append(args,
-			fmt.Sprintf("output.%s.enable", output.name),
-			fmt.Sprintf("output.%s.mode.%s", output.name, output.mode),
-			fmt.Sprintf("output.%s.position.%s", output.name, output.position),
-			fmt.Sprintf("output.%s.scale.%s", output.name, output.scale),
+	cmd.Name = name
+
+	profile, err := readProfile(cmd.Name)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Format != "" {
+		return printTemplate(cmd.Format, namedProfile{Name: cmd.Name, Profile: profile})
+	}
+
+	return printProfile(profile, cmd.JSON)
+}
+
+func (cmd CurrentCmd) Run(globals *Globals) error {
+	result, err := currentScreenSetup(globals)
+	if err != nil {
+		return fmt.Errorf("failed to load current screen setup: %w", err)
+	}
+
+	profile, err := display.Save(result, display.SaveOptions{Logger: globals.log()})
+	if err != nil {
+		return err
+	}
+
+	return printProfile(profile, cmd.JSON)
+}
+
+// namedProfile is a profile along with the name it's stored under.
+type namedProfile struct {
+	Name string `json:"name"`
+	display.Profile
+}
+
+// printTemplate renders the Go template once per profile, each followed by a
+// newline.
+func printTemplate(format string, profiles ...namedProfile) error {
+	tmpl, err := template.New("format").Parse(format)
+	if err != nil {
+		return fmt.Errorf("failed to parse format: %w", err)
+	}
+	for _, profile := range profiles {
+		if err := tmpl.Execute(os.Stdout, profile); err != nil {
+			return fmt.Errorf("failed to format profile %s: %w", profile.Name, err)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// printProfile prints the profile either as a table or as indented JSON.
+func printProfile(profile display.Profile, asJSON bool) error {
+	if asJSON {
+		b, err := json.MarshalIndent(profile, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to serialize profile: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	color := colorizer(os.Stdout)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%sNAME\tSIZE\tPOSITION\tREFRESH RATE\tSCALE\tDESCRIPTION%s\n", color(colorBold), color(colorReset))
+	for _, screen := range profile.Screens {
+		if !screen.IsEnabled() {
+			fmt.Fprintf(w, "%s%s\tdisabled\t\t\t\t%s%s\n", color(colorDim), screen.Name, screen.Description, color(colorReset))
+			continue
+		}
+		fmt.Fprintf(w, "%s%s\t%dx%d\t%d,%d\t%.2f Hz\t%g\t%s%s\n",
+			color(colorReset),
+			screen.Name,
+			screen.Size.Width, screen.Size.Height,
+			screen.Position.X, screen.Position.Y,
+			screen.RefreshRate,
+			screen.Scale,
+			screen.Description,
+			color(colorReset),
 		)
 	}
+	return w.Flush()
+}
+
+func (cmd DeleteProfileCmd) Run() error {
+	// Abbreviated names are only resolved when the prompt shows which
+	// profile they resolved to. Scripts must name the profile exactly.
+	interactive := !cmd.Force && isTerminal(os.Stdin)
+	if interactive {
+		name, err := resolveProfileName(cmd.Name)
+		if err != nil {
+			return err
+		}
+		cmd.Name = name
+	}
+
+	exists, err := profileExists(cmd.Name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if cmd.Force {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, cmd.Name)
+	}
+
+	if interactive {
+		ok, err := confirm(fmt.Sprintf("Delete profile %s?", cmd.Name))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+
+	return deleteProfile(cmd.Name)
+}
+
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// ANSI escape sequences used to color table rows. They all have the same
+// length, so tabwriter keeps aligning rows of different colors.
+const (
+	colorReset = "\x1b[00m"
+	colorBold  = "\x1b[01m"
+	colorDim   = "\x1b[02m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+)
 
-	return exec.Command("kscreen-doctor", args...).Run()
+// colorizer returns a function returning the given escape sequence if output
+// to f should be colored, which is the case for terminals unless NO_COLOR is
+// set, and an empty string otherwise.
+func colorizer(f *os.File) func(color string) string {
+	enabled := os.Getenv("NO_COLOR") == "" && isTerminal(f)
+	return func(color string) string {
+		if !enabled {
+			return ""
+		}
+		return color
+	}
 }
 
-func currentScreenSetup() (KScreenDoctorResult, error) {
-	cmd := exec.Command("kscreen-doctor", "--json")
-	output, err := cmd.StdoutPipe()
+// confirm asks a yes/no question on stdin. Anything but "y" or "yes" is
+// treated as no.
+func confirm(question string) (bool, error) {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("failed to read answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// profileNames returns the names of all profiles in the profiles directory.
+// Hidden profiles like the backup and the store file are left out.
+func profileNames() ([]string, error) {
+	if singleStore {
+		return storeNames()
+	}
+
+	dir, err := profilesDir()
 	if err != nil {
-		return KScreenDoctorResult{}, fmt.Errorf("failed to pipe kscreen-doctor: %w", err)
+		return nil, err
 	}
-	defer output.Close()
 
-	var result KScreenDoctorResult
-	var decodeError error
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read profile directory: %w", err)
+	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		decodeError = json.NewDecoder(output).Decode(&result)
-		defer wg.Done()
-	}()
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" || strings.HasPrefix(entry.Name(), ".") || entry.Name() == storeFile {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return names, nil
+}
 
-	if err := cmd.Run(); err != nil {
-		return KScreenDoctorResult{}, fmt.Errorf("failed to run kscreen-doctor: %w", err)
+// profilesDir returns the directory profiles are stored in, which is
+// $XDG_CONFIG_HOME/kdedisplayprofile (or ~/.config/kdedisplayprofile).
+func profilesDir() (string, error) {
+	if profileDir != "" {
+		return profileDir, nil
 	}
 
-	wg.Wait()
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine config directory: %w", err)
+	}
+	return filepath.Join(configDir, "kdedisplayprofile"), nil
+}
+
+// profileDir overrides the profiles directory if set.
+var profileDir string
+
+// configPaths returns the config files flag defaults are read from, which is
+// $XDG_CONFIG_HOME/kdedisplayprofile/config.toml.
+func configPaths() []string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(configDir, "kdedisplayprofile", "config.toml")}
+}
 
-	if decodeError != nil {
-		return KScreenDoctorResult{}, fmt.Errorf("failed to decode kscreen-doctor result: %w", decodeError)
+// autoProfileName derives a filesystem safe profile name from the connected
+// outputs, calling internal panels "laptop".
+func autoProfileName(result display.KScreenDoctorResult) string {
+	var parts []string
+	for _, output := range result.Outputs {
+		if !output.Connected && !output.Enabled {
+			continue
+		}
+		name := output.Name
+		for _, prefix := range []string{"eDP", "LVDS", "DSI"} {
+			if strings.HasPrefix(name, prefix) {
+				name = "laptop"
+				break
+			}
+		}
+		name = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-", r) {
+				return r
+			}
+			return '-'
+		}, name)
+		parts = append(parts, name)
+	}
+	if len(parts) == 0 {
+		return "empty"
 	}
+	slices.Sort(parts)
+	// Keep the internal panel first, it reads more naturally.
+	if i := slices.Index(parts, "laptop"); i > 0 {
+		parts = append([]string{"laptop"}, slices.Delete(parts, i, i+1)...)
+	}
+	return strings.Join(parts, "+")
+}
 
+// profilePath resolves a profile name to its file. Names containing a path
+// separator are used as explicit paths, bare names are looked up in the
+// profiles directory.
+func profilePath(name string) (string, error) {
+	if strings.ContainsRune(name, '/') {
+		return name, nil
+	}
+
+	dir, err := profilesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// resolveProfileName expands an abbreviated profile name to the saved profile
+// it uniquely identifies, preferring prefix over substring matches. Exact
+// names and paths are returned as is.
+func resolveProfileName(name string) (string, error) {
+	if name == "-" || strings.ContainsRune(name, '/') {
+		return name, nil
+	}
+
+	names, err := profileNames()
+	if err != nil {
+		return "", err
+	}
+	if slices.Contains(names, name) {
+		return name, nil
+	}
+
+	for _, matches := range []func(string, string) bool{strings.HasPrefix, strings.Contains} {
+		candidates := lo.Filter(names, func(candidate string, _ int) bool {
+			return matches(candidate, name)
+		})
+		switch len(candidates) {
+		case 0:
+			continue
+		case 1:
+			return candidates[0], nil
+		default:
+			return "", fmt.Errorf("profile name %s is ambiguous, it matches %s", name, strings.Join(candidates, ", "))
+		}
+	}
+
+	// Let hidden profiles like the backup through, readProfile reports
+	// whether they exist.
+	if strings.HasPrefix(name, ".") {
+		return name, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+}
+
+func (cmd ApplyCmd) Run(globals *Globals) error {
+	var targetOutputs []display.Target
+	for _, spec := range cmd.Outputs {
+		targetOutput, err := parseOutputSpec(spec)
+		if err != nil {
+			return err
+		}
+		targetOutputs = append(targetOutputs, targetOutput)
+	}
+
+	return applyOutputs(globals, targetOutputs, cmd.Disable, cmd.DryRun)
+}
+
+// parseOutputSpec parses a comma separated list of key=value pairs describing
+// an output. Since positions contain a comma themselves, items without a key
+// are appended to the previous value.
+func parseOutputSpec(spec string) (display.Target, error) {
+	values := make(map[string]string)
+	var lastKey string
+	for _, item := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(item, "=")
+		if !found {
+			if lastKey == "" {
+				return display.Target{}, fmt.Errorf("invalid output spec %q", spec)
+			}
+			values[lastKey] += "," + item
+			continue
+		}
+		values[key] = value
+		lastKey = key
+	}
+
+	var targetOutput display.Target
+	for key, value := range values {
+		switch key {
+		case "name":
+			targetOutput.Name = value
+		case "mode":
+			targetOutput.Mode = value
+		case "pos", "position":
+			position, err := display.ParsePosition(value)
+			if err != nil {
+				return display.Target{}, fmt.Errorf("invalid position %q in output spec %q", value, spec)
+			}
+			targetOutput.Position = position.String()
+		case "scale":
+			scale, err := strconv.ParseFloat(value, 64)
+			if err != nil || scale <= 0 {
+				return display.Target{}, fmt.Errorf("invalid scale %q in output spec %q", value, spec)
+			}
+			targetOutput.Scale = display.FormatScale(scale)
+		case "rotation":
+			if !slices.Contains([]string{"normal", "left", "inverted", "right"}, value) {
+				return display.Target{}, fmt.Errorf("invalid rotation %q in output spec %q", value, spec)
+			}
+			targetOutput.Rotation = value
+		default:
+			return display.Target{}, fmt.Errorf("unknown key %q in output spec %q", key, spec)
+		}
+	}
+	if targetOutput.Name == "" {
+		return display.Target{}, fmt.Errorf("output spec %q is missing a name", spec)
+	}
+
+	return targetOutput, nil
+}
+
+// buildPowerArgs returns the backend arguments switching the power state of
+// the target outputs, if they have one.
+func buildPowerArgs(globals *Globals, backend Backend, targetOutputs []display.Target, disabledOutputs []string) ([]string, error) {
+	if !slices.ContainsFunc(targetOutputs, func(output display.Target) bool { return output.Dpms != "" }) {
+		return nil, nil
+	}
+
+	// Outputs left untouched mustn't be powered off along the way.
+	currentScreen, err := currentScreenSetup(globals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load current screen setup: %w", err)
+	}
+	var otherOutputs []string
+	for _, output := range currentScreen.Outputs {
+		if output.Enabled && !slices.Contains(disabledOutputs, output.Name) &&
+			!slices.ContainsFunc(targetOutputs, func(target display.Target) bool { return target.Name == output.Name }) {
+			otherOutputs = append(otherOutputs, output.Name)
+		}
+	}
+	return backend.PowerArgs(targetOutputs, otherOutputs), nil
+}
+
+// applyOutputs enables and configures the target outputs and disables the
+// given ones using the selected backend.
+func applyOutputs(globals *Globals, targetOutputs []display.Target, disabledOutputs []string, dryRun bool) error {
+	backend := globals.backend()
+	args := backend.BuildArgs(targetOutputs, disabledOutputs)
+
+	powerArgs, err := buildPowerArgs(globals, backend, targetOutputs, disabledOutputs)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		// Print commands that can be pasted into a shell as they are.
+		name := backend.Name()
+		if globals.Backend == "kscreen-doctor" && globals.KScreenDoctor != "" {
+			name = globals.KScreenDoctor
+		}
+		fmt.Println(shellCommand(name, args...))
+		if len(powerArgs) > 0 {
+			fmt.Println(shellCommand(name, powerArgs...))
+		}
+		return nil
+	}
+
+	// Even a failed attempt might have changed some outputs.
+	defer globals.invalidateScreenSetup()
+
+	done := globals.measure("apply")
+	err = backend.Apply(args...)
+	if fallbackOutputs, ok := display.WithFallbackModes(targetOutputs); err != nil && ok {
+		globals.log().Debug("retrying with explicit mode geometry", "error", err)
+		err = backend.Apply(backend.BuildArgs(fallbackOutputs, disabledOutputs)...)
+	}
+	done()
+	if err != nil {
+		return fmt.Errorf("failed to apply profile: %w", err)
+	}
+
+	if len(powerArgs) > 0 {
+		defer globals.measure("switch power state")()
+		if err := backend.Apply(powerArgs...); err != nil {
+			return fmt.Errorf("failed to switch power state: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readProfile reads and parses the profile with the given name or path, or
+// from stdin if the name is "-".
+func readProfile(name string) (display.Profile, error) {
+	if inStore(name) {
+		profiles, err := readStore()
+		if err != nil {
+			return display.Profile{}, err
+		}
+		profile, exists := profiles[name]
+		if !exists {
+			return display.Profile{}, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+		}
+		return profile, nil
+	}
+
+	var b []byte
+	var err error
+	if name == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		var path string
+		path, err = profilePath(name)
+		if err != nil {
+			return display.Profile{}, err
+		}
+		b, err = os.ReadFile(path)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return display.Profile{}, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+	if err != nil {
+		return display.Profile{}, fmt.Errorf("failed to read profile: %w", err)
+	}
+	var profile display.Profile
+	if err := decodeProfileJSON(b, &profile); err != nil {
+		return display.Profile{}, fmt.Errorf("failed to deserialize profile: %w", err)
+	}
+	return profile, nil
+}
+
+// strictJSON rejects unknown fields when decoding profiles.
+var strictJSON bool
+
+// decodeProfileJSON decodes profile JSON into v. Unknown fields are ignored
+// unless strictJSON is set, so profiles of newer versions stay readable.
+func decodeProfileJSON(b []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	if strictJSON {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the profile")
+	}
+	return nil
+}
+
+// currentScreenSetup returns the current screen setup. It is only queried
+// once per run, unless it is invalidated by applying changes.
+func currentScreenSetup(globals *Globals) (display.KScreenDoctorResult, error) {
+	if globals.setup == nil {
+		var result display.KScreenDoctorResult
+		var err error
+		if globals.KScreenJSON != "" {
+			result, err = readKScreenJSON(globals.KScreenJSON)
+		} else {
+			done := globals.measure("query setup")
+			result, err = globals.backend().CurrentSetup()
+			done()
+		}
+		if err != nil {
+			return display.KScreenDoctorResult{}, err
+		}
+		globals.setup = &result
+	}
+
+	// Callers are free to reorder the outputs.
+	result := *globals.setup
+	result.Outputs = slices.Clone(result.Outputs)
 	return result, nil
 }
 
+// readKScreenJSON reads a kscreen-doctor --json dump from the given file, or
+// stdin if it is "-".
+func readKScreenJSON(path string) (display.KScreenDoctorResult, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return display.KScreenDoctorResult{}, fmt.Errorf("failed to read kscreen-doctor dump: %w", err)
+	}
+	return display.DecodeKScreenDoctor(b)
+}
+
+// invalidateScreenSetup makes the next currentScreenSetup query the backend
+// again.
+func (g *Globals) invalidateScreenSetup() {
+	g.setup = nil
+}
+
+// newParser creates the command line parser filling cli, reading flag
+// defaults from the given config files.
+func newParser(cli *CLI, configPaths ...string) *kong.Kong {
+	return kong.Must(cli,
+		kong.Name("kdedisplayprofile"),
+		kong.Vars{"backup_profile": backupProfile, "store_file": storeFile, "default_profile": defaultProfile},
+		kong.Configuration(kongtoml.Loader, configPaths...),
+	)
+}
+
+// useGlobals applies the global flags kept in package variables.
+func (cli *CLI) useGlobals() {
+	profileDir = cli.ProfileDir
+	singleStore = cli.Store == "single"
+	strictJSON = cli.StrictJSON
+}
+
 func main() {
 	var cli CLI
-	ctx := kong.Parse(&cli, kong.Name("kdedisplayprofile"))
-	ctx.FatalIfErrorf(ctx.Error)
+	parser := newParser(&cli, configPaths()...)
+	kongplete.Complete(parser, kongplete.WithPredictor("profile", profilePredictor(configPaths()...)))
 
-	ctx.FatalIfErrorf(ctx.Run())
+	ctx, err := parser.Parse(os.Args[1:])
+	parser.FatalIfErrorf(err)
+	cli.useGlobals()
+
+	err = ctx.Run(&cli.Globals)
+	if cli.Timings {
+		cli.printTimings()
+	}
+	if err != nil {
+		if cli.JSONErrors {
+			_ = json.NewEncoder(os.Stdout).Encode(newJSONError(err))
+		} else {
+			parser.Errorf("%s", err)
+		}
+		parser.Exit(exitCode(err))
+	}
 }
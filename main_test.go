@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+// dockedDump is a recorded kscreen-doctor --json dump of a laptop with a
+// monitor left of it, an unused HDMI monitor and an unconnected port.
+const dockedDump = "pkg/display/testdata/docked.json"
+
+// run runs the command line like main does.
+func run(t *testing.T, args ...string) error {
+	t.Helper()
+	var cli CLI
+	ctx, err := newParser(&cli).Parse(args)
+	if err != nil {
+		return err
+	}
+	cli.useGlobals()
+	return ctx.Run(&cli.Globals)
+}
+
+// fakeKScreenDoctor substitutes kscreen-doctor with the test binary, which
+// reports the given dump and records the args it is applied with. It returns
+// a function reading them, one invocation per line.
+func fakeKScreenDoctor(t *testing.T, dump string) func() []string {
+	t.Helper()
+	dump, err := filepath.Abs(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argsFile := filepath.Join(t.TempDir(), "args")
+
+	originalLookPath, originalExecCommand := lookPath, execCommand
+	t.Cleanup(func() {
+		lookPath, execCommand = originalLookPath, originalExecCommand
+	})
+	lookPath = func(file string) (string, error) {
+		return file, nil
+	}
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, os.Args[0], append([]string{"-test.run=TestFakeKScreenDoctor", "--", name}, args...)...)
+		cmd.Env = append(os.Environ(), "FAKE_KSCREEN_DOCTOR_DUMP="+dump, "FAKE_KSCREEN_DOCTOR_ARGS="+argsFile)
+		return cmd
+	}
+	t.Setenv("WAYLAND_DISPLAY", "wayland-0")
+	t.Setenv("XDG_CURRENT_DESKTOP", "KDE")
+
+	return func() []string {
+		b, err := os.ReadFile(argsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+}
+
+// TestFakeKScreenDoctor acts as kscreen-doctor when run by
+// fakeKScreenDoctor.
+func TestFakeKScreenDoctor(t *testing.T) {
+	argsFile := os.Getenv("FAKE_KSCREEN_DOCTOR_ARGS")
+	if argsFile == "" {
+		return
+	}
+	args := os.Args[slices.Index(os.Args, "--")+2:]
+	switch strings.Join(args, " ") {
+	case "--json":
+		b, err := os.ReadFile(os.Getenv("FAKE_KSCREEN_DOCTOR_DUMP"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(b)
+	case "--version":
+		fmt.Println("kscreen-doctor 6.1.0")
+	default:
+		f, err := os.OpenFile(argsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(f, strings.Join(args, " "))
+		f.Close()
+	}
+	os.Exit(0)
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	if err := run(t, "-q", "--profile-dir", dir, "--kscreen-json", dockedDump, "save", "docked"); err != nil {
+		t.Fatal(err)
+	}
+
+	appliedArgs := fakeKScreenDoctor(t, dockedDump)
+	if err := run(t, "-q", "--profile-dir", dir, "load", "docked"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{strings.Join([]string{
+		"output.DP-2.disable",
+		"output.HDMI-A-1.disable",
+		"output.DP-1.enable",
+		"output.DP-1.mode.2560x1440@144",
+		"output.DP-1.position.0,0",
+		"output.DP-1.scale.1",
+		"output.DP-1.rotation.normal",
+		"output.DP-1.priority.1",
+		"output.DP-1.vrrpolicy.automatic",
+		"output.DP-1.hdr.disable",
+		"output.DP-1.wcg.disable",
+		"output.eDP-1.enable",
+		"output.eDP-1.mode.1920x1200@60",
+		"output.eDP-1.position.2560,240",
+		"output.eDP-1.scale.1.25",
+		"output.eDP-1.rotation.normal",
+		"output.eDP-1.priority.2",
+		"output.eDP-1.vrrpolicy.never",
+	}, " ")}
+	if got := appliedArgs(); !slices.Equal(got, want) {
+		t.Errorf("got args\n%q\nwant\n%q", got, want)
+	}
+
+	// Loading backs up the setup it replaces.
+	if _, err := os.Stat(filepath.Join(dir, backupProfile+".json")); err != nil {
+		t.Errorf("no backup: %v", err)
+	}
+}
+
+func TestDeleteForceNeedsExactName(t *testing.T) {
+	dir := t.TempDir()
+	if err := run(t, "-q", "--profile-dir", dir, "--kscreen-json", dockedDump, "save", "tmp-work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(t, "-q", "--profile-dir", dir, "delete", "-f", "tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tmp-work.json")); err != nil {
+		t.Errorf("delete -f tmp deleted tmp-work: %v", err)
+	}
+}
+
+func TestDefaultWithoutProfile(t *testing.T) {
+	// Right after login the session might not be ready yet.
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("DISPLAY", "")
+	if err := run(t, "-q", "--profile-dir", t.TempDir(), "default"); err != nil {
+		t.Errorf("default without a default profile failed: %v", err)
+	}
+}
+
+func TestSaveLargeSetup(t *testing.T) {
+	// Exceeds the 64 KiB of a pipe buffer, so kscreen-doctor blocks writing
+	// unless its output is read while it runs.
+	var setup display.KScreenDoctorResult
+	for i := range 16 {
+		output := display.Output{
+			Name:          fmt.Sprintf("DP-%d", i+1),
+			Enabled:       true,
+			Connected:     true,
+			Priority:      i + 1,
+			CurrentModeId: "1",
+			Size:          display.Size{Width: 1920, Height: 1080},
+			Pos:           display.Position{X: i * 1920},
+			Scale:         1,
+			Rotation:      display.RotationNone,
+		}
+		for j := range 100 {
+			output.Modes = append(output.Modes, display.Mode{
+				Id:          strconv.Itoa(j + 1),
+				Name:        fmt.Sprintf("1920x1080@%d", 60+j),
+				RefreshRate: float64(60 + j),
+				Size:        display.Size{Width: 1920, Height: 1080},
+			})
+		}
+		setup.Outputs = append(setup.Outputs, output)
+	}
+	b, err := json.Marshal(setup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) <= 64<<10 {
+		t.Fatalf("dump has only %d bytes", len(b))
+	}
+	dump := filepath.Join(t.TempDir(), "large.json")
+	if err := os.WriteFile(dump, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fakeKScreenDoctor(t, dump)
+	dir := t.TempDir()
+	if err := run(t, "-q", "--profile-dir", dir, "save", "large"); err != nil {
+		t.Fatal(err)
+	}
+	b, err = os.ReadFile(filepath.Join(dir, "large.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profile display.Profile
+	if err := json.Unmarshal(b, &profile); err != nil {
+		t.Fatal(err)
+	}
+	if len(profile.Screens) != len(setup.Outputs) {
+		t.Fatalf("got %d screens, want %d", len(profile.Screens), len(setup.Outputs))
+	}
+	for i, screen := range profile.Screens {
+		if screen.Name != setup.Outputs[i].Name || screen.RefreshRate != 60 {
+			t.Errorf("screen %d is %s at %g Hz, want %s at 60 Hz", i, screen.Name, screen.RefreshRate, setup.Outputs[i].Name)
+		}
+	}
+}
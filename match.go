@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+	"github.com/samber/lo"
+)
+
+type MatchCmd struct {
+	DryRun bool `help:"Print the kscreen-doctor command instead of running it."`
+
+	RefreshTolerance float64 `default:"1.0" placeholder:"HZ" help:"Maximum deviation from the recorded refresh rate."`
+}
+
+func (cmd MatchCmd) Run(globals *Globals) error {
+	currentScreen, err := currentScreenSetup(globals)
+	if err != nil {
+		return fmt.Errorf("failed to load current screen setup: %w", err)
+	}
+
+	name, profile, found, err := findBestProfile(globals, currentScreen)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("no saved profile matches the connected outputs")
+	}
+
+	globals.log().Info("applying profile", "profile", name)
+	// The best match might reference outputs that aren't connected.
+	return applyProfile(globals, profile, currentScreen, loadOptions{
+		LoadOptions: display.LoadOptions{
+			RefreshTolerance: cmd.RefreshTolerance,
+			SkipMissing:      true,
+		},
+	}, cmd.DryRun)
+}
+
+// connectedOutputs returns the outputs that are currently plugged in.
+func connectedOutputs(currentScreen display.KScreenDoctorResult) []display.Output {
+	return lo.Filter(currentScreen.Outputs, func(output display.Output, _ int) bool {
+		return output.Connected || output.Enabled
+	})
+}
+
+// profileScore counts how many of the profile's screens map to distinct
+// connected outputs, and how many don't.
+func profileScore(profile display.Profile, currentScreen display.KScreenDoctorResult) (matched, missing int) {
+	outputs := connectedOutputs(currentScreen)
+	outputByName := lo.Associate(outputs, func(output display.Output) (string, display.Output) {
+		return output.Name, output
+	})
+	matchedOutputs := make(map[string]bool)
+	for _, screen := range profile.Screens {
+		output, exists := display.FindOutput(outputs, outputByName, screen)
+		if !exists || matchedOutputs[output.Name] {
+			missing++
+			continue
+		}
+		matchedOutputs[output.Name] = true
+	}
+	return len(matchedOutputs), missing
+}
+
+// profileMatches reports whether the profile was recorded for exactly the set
+// of currently connected outputs.
+func profileMatches(profile display.Profile, currentScreen display.KScreenDoctorResult) bool {
+	matched, missing := profileScore(profile, currentScreen)
+	return missing == 0 && matched == len(connectedOutputs(currentScreen))
+}
+
+// findMatchingProfile looks for a saved profile recorded for the currently
+// connected outputs. Profiles that fail to load are skipped.
+func findMatchingProfile(globals *Globals, currentScreen display.KScreenDoctorResult) (string, display.Profile, bool, error) {
+	names, err := profileNames()
+	if err != nil {
+		return "", display.Profile{}, false, err
+	}
+
+	for _, name := range names {
+		profile, err := readProfile(name)
+		if err != nil {
+			globals.log().Warn("skipping profile", "profile", name, "error", err)
+			continue
+		}
+		if profileMatches(profile, currentScreen) {
+			return name, profile, true, nil
+		}
+	}
+	return "", display.Profile{}, false, nil
+}
+
+// findBestProfile looks for the saved profile covering most of the currently
+// connected outputs. Ties are broken in favor of the profile referencing the
+// fewest missing outputs.
+func findBestProfile(globals *Globals, currentScreen display.KScreenDoctorResult) (string, display.Profile, bool, error) {
+	names, err := profileNames()
+	if err != nil {
+		return "", display.Profile{}, false, err
+	}
+
+	var bestName string
+	var bestProfile display.Profile
+	var bestMatched, bestMissing int
+	for _, name := range names {
+		profile, err := readProfile(name)
+		if err != nil {
+			globals.log().Warn("skipping profile", "profile", name, "error", err)
+			continue
+		}
+		matched, missing := profileScore(profile, currentScreen)
+		if matched == 0 {
+			continue
+		}
+		if matched > bestMatched || (matched == bestMatched && missing < bestMissing) {
+			bestName, bestProfile, bestMatched, bestMissing = name, profile, matched, missing
+		}
+	}
+	return bestName, bestProfile, bestName != "", nil
+}
+
+// outputSetKey identifies the set of connected outputs, so changes to it can
+// be detected.
+func outputSetKey(currentScreen display.KScreenDoctorResult) string {
+	names := lo.Map(connectedOutputs(currentScreen), func(output display.Output, _ int) string {
+		return output.Name
+	})
+	slices.Sort(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+type MergeCmd struct {
+	Name     string   `arg:"1" help:"The name of the new profile."`
+	Profiles []string `arg:"1" predictor:"profile" help:"The profiles to merge. Screens of later profiles replace those of earlier ones with the same name."`
+	Force    bool     `short:"f" help:"Overwrite an existing profile with the new name."`
+}
+
+func (cmd MergeCmd) Run() error {
+	if len(cmd.Profiles) < 2 {
+		return errors.New("at least two profiles are needed to merge")
+	}
+
+	merged := display.Profile{Version: display.ProfileVersion}
+	for _, name := range cmd.Profiles {
+		profile, err := readProfile(name)
+		if err != nil {
+			return err
+		}
+		if err := profile.CheckVersion(); err != nil {
+			return err
+		}
+		merged = mergeProfiles(merged, profile)
+	}
+
+	if err := checkOverlaps(merged.Screens); err != nil {
+		return err
+	}
+
+	if !cmd.Force {
+		exists, err := profileExists(cmd.Name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("profile %s already exists", cmd.Name)
+		}
+	}
+	return writeProfile(cmd.Name, merged)
+}
+
+// mergeProfiles layers the overlay onto the base profile. Screens and hooks
+// of the overlay replace those of the base.
+func mergeProfiles(base, overlay display.Profile) display.Profile {
+	merged := base
+	merged.Screens = slices.Clone(base.Screens)
+	for _, screen := range overlay.Screens {
+		i := slices.IndexFunc(merged.Screens, func(other display.Screen) bool {
+			return other.Name == screen.Name
+		})
+		if i < 0 {
+			merged.Screens = append(merged.Screens, screen)
+		} else {
+			merged.Screens[i] = screen
+		}
+	}
+	if overlay.PreApply != "" {
+		merged.PreApply = overlay.PreApply
+	}
+	if overlay.PostApply != "" {
+		merged.PostApply = overlay.PostApply
+	}
+	if len(overlay.Tags) > 0 {
+		merged.Tags = overlay.Tags
+	}
+	return merged
+}
+
+// checkOverlaps reports enabled screens covering the same area. Mirrored
+// screens overlap their source on purpose and are left out.
+func checkOverlaps(screens []display.Screen) error {
+	var errs []error
+	for i, a := range screens {
+		if !a.IsEnabled() || a.Mirror != "" {
+			continue
+		}
+		for _, b := range screens[i+1:] {
+			if !b.IsEnabled() || b.Mirror != "" {
+				continue
+			}
+			sizeA, sizeB := display.LogicalSize(a), display.LogicalSize(b)
+			if a.Position.X < b.Position.X+sizeB.Width && b.Position.X < a.Position.X+sizeA.Width &&
+				a.Position.Y < b.Position.Y+sizeB.Height && b.Position.Y < a.Position.Y+sizeA.Height {
+				errs = append(errs, fmt.Errorf("screens %s and %s overlap", a.Name, b.Name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// pickProfile lets the user choose one of the saved profiles from a numbered
+// list on the terminal.
+func pickProfile() (string, error) {
+	if !isTerminal(os.Stdin) {
+		return "", errors.New("no profile given and stdin is not a terminal to pick one")
+	}
+
+	names, err := profileNames()
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", errors.New("there are no saved profiles to pick from")
+	}
+
+	for i, name := range names {
+		fmt.Printf("%3d) %s\n", i+1, name)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("Profile: ")
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("failed to read answer: %w", err)
+		}
+		answer = strings.TrimSpace(answer)
+
+		if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(names) {
+			return names[i-1], nil
+		}
+		if slices.Contains(names, answer) {
+			return answer, nil
+		}
+		fmt.Println("Please enter the number or name of a listed profile.")
+	}
+}
@@ -0,0 +1,171 @@
+package display
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// LogicalSize returns the size a screen occupies in the global layout, which
+// depends on its scale and rotation.
+func LogicalSize(screen Screen) Size {
+	size := screen.Size
+	if screen.Rotation == RotationLeft.String() || screen.Rotation == RotationRight.String() {
+		size.Width, size.Height = size.Height, size.Width
+	}
+	scale := screen.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	return Size{
+		Width:  int(math.Round(float64(size.Width) / scale)),
+		Height: int(math.Round(float64(size.Height) / scale)),
+	}
+}
+
+// layoutRegions groups the names of the screens at the given positions into
+// regions of screens sharing an edge with each other.
+func layoutRegions(screens []Screen, positions []Position) [][]string {
+	touches := func(i, j int) bool {
+		a, b := LogicalSize(screens[i]), LogicalSize(screens[j])
+		overlapX := min(positions[i].X+a.Width, positions[j].X+b.Width) - max(positions[i].X, positions[j].X)
+		overlapY := min(positions[i].Y+a.Height, positions[j].Y+b.Height) - max(positions[i].Y, positions[j].Y)
+		// Screens meeting only at a corner don't share an edge.
+		return overlapX >= 0 && overlapY >= 0 && (overlapX > 0 || overlapY > 0)
+	}
+
+	var regions [][]string
+	region := make([]int, len(screens))
+	for i := range region {
+		region[i] = -1
+	}
+	for i := range screens {
+		if region[i] >= 0 {
+			continue
+		}
+		region[i] = len(regions)
+		names := []string{screens[i].Name}
+		for queue := []int{i}; len(queue) > 0; queue = queue[1:] {
+			for j := range screens {
+				if region[j] < 0 && touches(queue[0], j) {
+					region[j] = region[i]
+					names = append(names, screens[j].Name)
+					queue = append(queue, j)
+				}
+			}
+		}
+		regions = append(regions, names)
+	}
+	return regions
+}
+
+// alignPositions recomputes the positions of the applied screens, so that
+// screens whose edges touched in the recorded layout still touch although
+// their sizes changed. Both slices must describe the same screens in the same
+// order.
+func alignPositions(recorded, applied []Screen) []Position {
+	positions := make([]Position, len(recorded))
+	for i := range recorded {
+		positions[i] = recorded[i].Position
+	}
+
+	alignAxis := func(
+		start func(Position) int,
+		extent func(Size) int,
+		set func(*Position, int),
+	) {
+		order := make([]int, len(recorded))
+		for i := range order {
+			order[i] = i
+		}
+		slices.SortFunc(order, func(a, b int) int {
+			return cmp.Compare(start(recorded[a].Position), start(recorded[b].Position))
+		})
+
+		for n, i := range order {
+			// Screens are processed in layout order, so any neighbor
+			// before this one already has its final position.
+			for _, j := range order[:n] {
+				if start(recorded[j].Position)+extent(LogicalSize(recorded[j])) == start(recorded[i].Position) {
+					set(&positions[i], start(positions[j])+extent(LogicalSize(applied[j])))
+					break
+				}
+			}
+		}
+	}
+
+	alignAxis(
+		func(p Position) int { return p.X },
+		func(s Size) int { return s.Width },
+		func(p *Position, x int) { p.X = x },
+	)
+	alignAxis(
+		func(p Position) int { return p.Y },
+		func(s Size) int { return s.Height },
+		func(p *Position, y int) { p.Y = y },
+	)
+
+	return positions
+}
+
+// MakePositionsRelative stores the positions of all enabled screens relative
+// to the first one, which is the primary output. Screens to the right of or
+// below it are measured from its far edges.
+func MakePositionsRelative(screens []Screen) {
+	primary := slices.IndexFunc(screens, Screen.IsEnabled)
+	if primary < 0 {
+		return
+	}
+	origin := screens[primary].Position
+	size := LogicalSize(screens[primary])
+
+	for i := range screens {
+		screen := &screens[i]
+		if i == primary || !screen.IsEnabled() || screen.Mirror != "" {
+			continue
+		}
+		relative := RelativePosition{
+			To: screens[primary].Name,
+			X:  screen.Position.X - origin.X,
+			Y:  screen.Position.Y - origin.Y,
+		}
+		if screen.Position.X >= origin.X+size.Width {
+			relative.X -= size.Width
+			relative.FromRight = true
+		}
+		if screen.Position.Y >= origin.Y+size.Height {
+			relative.Y -= size.Height
+			relative.FromBottom = true
+		}
+		screen.Relative = &relative
+	}
+}
+
+// resolveRelativePositions replaces the positions of screens placed relative
+// to another one, based on the other screen's applied size. Screens placed
+// relative to a screen that isn't applied keep their position.
+func resolveRelativePositions(applied []Screen, positions []Position) {
+	for i, screen := range applied {
+		if screen.Relative == nil {
+			continue
+		}
+		j := slices.IndexFunc(applied, func(other Screen) bool {
+			return other.Name == screen.Relative.To
+		})
+		if j < 0 || j == i {
+			continue
+		}
+		size := LogicalSize(applied[j])
+		position := Position{
+			X: positions[j].X + screen.Relative.X,
+			Y: positions[j].Y + screen.Relative.Y,
+		}
+		if screen.Relative.FromRight {
+			position.X += size.Width
+		}
+		if screen.Relative.FromBottom {
+			position.Y += size.Height
+		}
+		positions[i] = position
+	}
+}
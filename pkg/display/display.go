@@ -0,0 +1,253 @@
+// Package display converts between the screen setup reported by
+// kscreen-doctor and display profiles, and plans how to apply a profile to a
+// setup.
+package display
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Output struct {
+	Name           string     `json:"name"`
+	CurrentModeId  string     `json:"currentModeId"`
+	Enabled        bool       `json:"enabled"`
+	Connected      bool       `json:"connected"`
+	Size           Size       `json:"size"`
+	SizeMM         Size       `json:"sizeMM"` // physical size, zero if unknown
+	Pos            Position   `json:"pos"`
+	Scale          float64    `json:"scale"`
+	Modes          []Mode     `json:"modes"`
+	Priority       int        `json:"priority"`
+	Edid           Edid       `json:"edid"`
+	Rotation       Rotation   `json:"rotation"`
+	VrrPolicy      *VrrPolicy `json:"vrrPolicy"` // nil if kscreen-doctor doesn't report it
+	Hdr            *bool      `json:"hdr"`       // nil if kscreen-doctor doesn't report it
+	Wcg            *bool      `json:"wcg"`       // nil if kscreen-doctor doesn't report it
+	Overscan       int        `json:"overscan"`
+	Description    string     `json:"description"`
+	IccProfilePath string     `json:"iccProfilePath"` // empty if none is in use
+}
+
+// Describe returns a human readable name of the connected monitor, falling
+// back to its EDID vendor and model.
+func (o Output) Describe() string {
+	if o.Description != "" {
+		return o.Description
+	}
+	return strings.TrimSpace(o.Edid.Vendor + " " + o.Edid.Model)
+}
+
+// Edid holds the parts of a display's EDID that identify the physical
+// monitor independently of the connector it is plugged into.
+type Edid struct {
+	Vendor string `json:"vendor,omitempty"`
+	Model  string `json:"model,omitempty"`
+	Serial string `json:"serial,omitempty"`
+}
+
+// IsZero reports whether no identifying information is available.
+func (e Edid) IsZero() bool {
+	return e == Edid{}
+}
+
+// Rotation mirrors libkscreen's Output::Rotation, which kscreen-doctor
+// reports as a plain number.
+type Rotation int
+
+const (
+	RotationNone     Rotation = 1
+	RotationLeft     Rotation = 2
+	RotationInverted Rotation = 4
+	RotationRight    Rotation = 8
+)
+
+// String returns the rotation in the form kscreen-doctor accepts.
+func (r Rotation) String() string {
+	switch r {
+	case RotationLeft:
+		return "left"
+	case RotationInverted:
+		return "inverted"
+	case RotationRight:
+		return "right"
+	default:
+		return "normal"
+	}
+}
+
+// VrrPolicy mirrors libkscreen's Output::VrrPolicy.
+type VrrPolicy int
+
+const (
+	VrrPolicyNever     VrrPolicy = 0
+	VrrPolicyAlways    VrrPolicy = 1
+	VrrPolicyAutomatic VrrPolicy = 2
+)
+
+// String returns the policy in the form kscreen-doctor accepts.
+func (p VrrPolicy) String() string {
+	switch p {
+	case VrrPolicyAlways:
+		return "always"
+	case VrrPolicyAutomatic:
+		return "automatic"
+	default:
+		return "never"
+	}
+}
+
+type Mode struct {
+	Id          string  `json:"id"`
+	Name        string  `json:"name"`
+	RefreshRate float64 `json:"refreshRate"`
+	Size        Size    `json:"size"`
+}
+
+type Size struct {
+	Height int `json:"height"`
+	Width  int `json:"width"`
+}
+
+type Position struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// String formats the position as X,Y, the way kscreen-doctor expects it.
+// Negative coordinates keep their sign, e.g. -1920,0.
+func (p Position) String() string {
+	return fmt.Sprintf("%d,%d", p.X, p.Y)
+}
+
+// ParsePosition parses a position given as X,Y. Spaces around the
+// coordinates and explicit signs are allowed, e.g. "-1920, +0".
+func ParsePosition(s string) (Position, error) {
+	x, y, ok := strings.Cut(s, ",")
+	if !ok {
+		return Position{}, fmt.Errorf("invalid position %q, expected X,Y", s)
+	}
+	var position Position
+	var errX, errY error
+	position.X, errX = strconv.Atoi(strings.TrimSpace(x))
+	position.Y, errY = strconv.Atoi(strings.TrimSpace(y))
+	if errX != nil || errY != nil {
+		return Position{}, fmt.Errorf("invalid position %q, expected X,Y", s)
+	}
+	return position, nil
+}
+
+type KScreenDoctorResult struct {
+	Outputs []Output `json:"outputs"`
+	// Features is the compositor's set of supported features. It is 0 if
+	// the backend doesn't report it.
+	Features Feature `json:"features"`
+}
+
+// Feature is a flag describing a capability of the compositor.
+//
+// Global scaling settings, like whether Xwayland applications scale
+// themselves, can't be changed through kscreen-doctor and are not part of a
+// profile.
+type Feature int
+
+// FeaturePerOutputScaling means each output can have a scale of its own.
+const FeaturePerOutputScaling Feature = 1 << 2
+
+// Supports reports whether the compositor supports the feature. Without
+// reported features, everything is assumed to be supported.
+func (r KScreenDoctorResult) Supports(feature Feature) bool {
+	return r.Features == 0 || r.Features&feature != 0
+}
+
+// ProfileVersion is the version of the profile format written by this
+// package. Profiles without a version predate versioning and are treated as
+// version 0.
+//
+// Version 2 added HDR and wide color gamut settings, version 3 added hooks.
+const ProfileVersion = 3
+
+type Profile struct {
+	// Schema optionally points editors to the JSON schema of profiles.
+	Schema string `json:"$schema,omitempty"`
+
+	Version int      `json:"version"`
+	Screens []Screen `json:"screens"`
+
+	// BackendVersion is the version of the tool the profile was saved with,
+	// e.g. "kscreen-doctor 6.1.0". It is empty if unknown.
+	BackendVersion string `json:"backendVersion,omitempty"`
+
+	// Tags help organizing profiles, e.g. "home" or "docked". They don't
+	// affect how the profile is applied.
+	Tags []string `json:"tags,omitempty"`
+
+	// PreApply and PostApply are shell commands run before and after the
+	// profile is applied.
+	PreApply  string `json:"preApply,omitempty"`
+	PostApply string `json:"postApply,omitempty"`
+}
+
+// CheckVersion makes sure the profile doesn't use features this package
+// doesn't know about.
+func (p Profile) CheckVersion() error {
+	if p.Version > ProfileVersion {
+		return fmt.Errorf("profile version %d is newer than the supported version %d, please update kdedisplayprofile", p.Version, ProfileVersion)
+	}
+	return nil
+}
+
+type Screen struct {
+	Name        string   `json:"name"`
+	Size        Size     `json:"size"`
+	Position    Position `json:"position"`
+	RefreshRate float64  `json:"refreshRate"`
+	// RefreshStrategy picks the refresh rate when loading: "exact" (the
+	// default) for the one closest to RefreshRate, "max" or "min" for the
+	// highest or lowest one available, or a rate in Hz. "exact" falls back
+	// to "max" if RefreshRate is 0.
+	RefreshStrategy string  `json:"refreshStrategy,omitempty"`
+	Scale           float64 `json:"scale"`
+	Edid            Edid    `json:"edid"`
+	Rotation        string  `json:"rotation,omitempty"`
+	Priority        int     `json:"priority,omitempty"`
+	Primary         bool    `json:"primary,omitempty"` // placed first regardless of Priority
+	VrrPolicy       string  `json:"vrrPolicy,omitempty"`
+	Hdr             *bool   `json:"hdr,omitempty"`
+	Wcg             *bool   `json:"wcg,omitempty"`
+	Enabled         *bool   `json:"enabled,omitempty"` // nil means enabled
+	Overscan        int     `json:"overscan,omitempty"`
+	Dpms            string  `json:"dpms,omitempty"`         // on or off, independent of Enabled
+	ColorProfile    string  `json:"colorProfile,omitempty"` // path to an ICC profile
+	Mirror          string  `json:"mirror,omitempty"`       // screen sharing this one's position
+	Description     string  `json:"description,omitempty"`
+
+	// Relative, if set, takes precedence over Position when loading.
+	Relative *RelativePosition `json:"relative,omitempty"`
+}
+
+// RelativePosition places a screen relative to another one, so the layout
+// survives changes of the other screen's size.
+type RelativePosition struct {
+	To string `json:"to"`
+	X  int    `json:"x"`
+	Y  int    `json:"y"`
+	// FromRight and FromBottom measure X and Y from the far edges of the
+	// other screen instead of its origin.
+	FromRight  bool `json:"fromRight,omitempty"`
+	FromBottom bool `json:"fromBottom,omitempty"`
+}
+
+// Label returns the screen's name along with its description, if known.
+func (s Screen) Label() string {
+	if s.Description == "" {
+		return s.Name
+	}
+	return fmt.Sprintf("%s (%s)", s.Name, s.Description)
+}
+
+// IsEnabled reports whether the screen should be turned on.
+func (s Screen) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
@@ -0,0 +1,60 @@
+package display
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePosition(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Position
+	}{
+		{"0,0", Position{0, 0}},
+		{"-1920,0", Position{-1920, 0}},
+		{" +0 , -1080 ", Position{0, -1080}},
+		{"7680,2160", Position{7680, 2160}},
+		{"-7680,-4320", Position{-7680, -4320}},
+	}
+	for _, test := range tests {
+		got, err := ParsePosition(test.input)
+		if err != nil {
+			t.Errorf("ParsePosition(%q): %v", test.input, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParsePosition(%q) = %v, want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParsePositionMalformed(t *testing.T) {
+	for _, input := range []string{"", "1920", "1920x0", "1920,", ",0", "a,b", "1.5,0", "1,2,3", "--1,0"} {
+		if position, err := ParsePosition(input); err == nil {
+			t.Errorf("ParsePosition(%q) = %v, want an error", input, position)
+		}
+	}
+}
+
+func TestPositionArgs(t *testing.T) {
+	tests := []struct {
+		position Position
+		want     string
+	}{
+		{Position{-1920, 0}, "output.HDMI-A-1.position.-1920,0"},
+		{Position{0, -1080}, "output.HDMI-A-1.position.0,-1080"},
+		{Position{7680, 2160}, "output.HDMI-A-1.position.7680,2160"},
+	}
+	for _, test := range tests {
+		args := KScreenDoctorArgs([]Target{{Name: "HDMI-A-1", Position: test.position.String()}}, nil)
+		if !slices.Contains(args, test.want) {
+			t.Errorf("position %v: got args %q, want %s", test.position, args, test.want)
+		}
+
+		// Positions from the command line use the same format.
+		parsed, err := ParsePosition(test.position.String())
+		if err != nil || parsed != test.position {
+			t.Errorf("ParsePosition(%q) = %v, %v, want %v", test.position.String(), parsed, err, test.position)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package display
+
+import (
+	"log/slog"
+	"math"
+)
+
+// The DPI a scale of 1 is designed for, and the range of effective DPIs that
+// still look reasonable.
+const (
+	referenceDPI    = 96
+	minEffectiveDPI = 72
+	maxEffectiveDPI = 144
+)
+
+// checkDPI warns if the screen's scale results in an effective DPI outside
+// the reasonable range on the output's monitor, suggesting a better scale.
+// Monitors not reporting their physical size are skipped.
+func checkDPI(output Output, screen Screen, logger *slog.Logger) {
+	if output.SizeMM.Width <= 0 || screen.Scale <= 0 {
+		return
+	}
+
+	dpi := float64(screen.Size.Width) / (float64(output.SizeMM.Width) / 25.4)
+	effectiveDPI := dpi / screen.Scale
+	if effectiveDPI >= minEffectiveDPI && effectiveDPI <= maxEffectiveDPI {
+		return
+	}
+
+	// Scales usually come in steps of 25%.
+	suggested := max(1, math.Round(dpi/referenceDPI*4)/4)
+	logger.Warn("scale results in an unusual effective DPI",
+		"output", output.Name, "scale", screen.Scale, "dpi", math.Round(effectiveDPI), "suggested", suggested)
+}
@@ -0,0 +1,29 @@
+package display
+
+import "errors"
+
+var (
+	// ErrOutputMissing is returned if a profile references an output that
+	// isn't connected.
+	ErrOutputMissing = errors.New("missing output")
+	// ErrNoMatchingMode is returned if an output doesn't support the
+	// resolution or refresh rate requested by a profile.
+	ErrNoMatchingMode = errors.New("no matching mode")
+	// ErrNoOutputEnabled is returned if applying a profile would leave all
+	// outputs disabled.
+	ErrNoOutputEnabled = errors.New("profile would leave no output enabled")
+)
+
+// OutputError attributes an error to the output it was caused by.
+type OutputError struct {
+	Output string
+	Err    error
+}
+
+func (e *OutputError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *OutputError) Unwrap() error {
+	return e.Err
+}
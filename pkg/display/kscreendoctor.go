@@ -0,0 +1,107 @@
+package display
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Current queries the current screen setup from kscreen-doctor. run invokes
+// kscreen-doctor with the given arguments and returns its stdout, so callers
+// decide how the binary is found and executed, e.g.
+//
+//	display.Current(func(args ...string) ([]byte, error) {
+//		return exec.Command("kscreen-doctor", args...).Output()
+//	})
+func Current(run func(args ...string) ([]byte, error)) (KScreenDoctorResult, error) {
+	output, err := run("--json")
+	if err != nil {
+		return KScreenDoctorResult{}, err
+	}
+	return DecodeKScreenDoctor(output)
+}
+
+// DecodeKScreenDoctor parses the output of kscreen-doctor --json.
+func DecodeKScreenDoctor(output []byte) (KScreenDoctorResult, error) {
+	var result KScreenDoctorResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return KScreenDoctorResult{}, fmt.Errorf("failed to decode kscreen-doctor result: %w", err)
+	}
+	return result, nil
+}
+
+// KScreenDoctorArgs assembles the kscreen-doctor arguments that disable the
+// given outputs and configure the target outputs, in that order.
+func KScreenDoctorArgs(targetOutputs []Target, disabledOutputs []string) []string {
+	var args []string
+	for _, outputName := range disabledOutputs {
+		args = append(args, fmt.Sprintf("output.%s.disable", outputName))
+	}
+	for _, output := range targetOutputs {
+		args = append(args, fmt.Sprintf("output.%s.enable", output.Name))
+		if output.Mode != "" {
+			args = append(args, fmt.Sprintf("output.%s.mode.%s", output.Name, output.Mode))
+		}
+		if output.Position != "" {
+			args = append(args, fmt.Sprintf("output.%s.position.%s", output.Name, output.Position))
+		}
+		if output.Scale != "" {
+			args = append(args, fmt.Sprintf("output.%s.scale.%s", output.Name, output.Scale))
+		}
+		if output.Rotation != "" {
+			args = append(args, fmt.Sprintf("output.%s.rotation.%s", output.Name, output.Rotation))
+		}
+		if output.Priority != 0 {
+			args = append(args, fmt.Sprintf("output.%s.priority.%d", output.Name, output.Priority))
+		}
+		if output.Primary {
+			// Older versions don't know about priorities.
+			args = append(args, fmt.Sprintf("output.%s.primary", output.Name))
+		}
+		if output.VrrPolicy != "" {
+			args = append(args, fmt.Sprintf("output.%s.vrrpolicy.%s", output.Name, output.VrrPolicy))
+		}
+		if output.Hdr != "" {
+			args = append(args, fmt.Sprintf("output.%s.hdr.%s", output.Name, output.Hdr))
+		}
+		if output.Wcg != "" {
+			args = append(args, fmt.Sprintf("output.%s.wcg.%s", output.Name, output.Wcg))
+		}
+		if output.Overscan != 0 {
+			args = append(args, fmt.Sprintf("output.%s.overscan.%d", output.Name, output.Overscan))
+		}
+		if output.ColorProfile != "" {
+			args = append(args, fmt.Sprintf("output.%s.iccprofile.%s", output.Name, output.ColorProfile))
+		}
+	}
+	return args
+}
+
+// KScreenDoctorDpmsArgs assembles the kscreen-doctor arguments switching the
+// power state of the target outputs, which needs an invocation of its own.
+// kscreen-doctor can only power off all outputs except the excluded ones, so
+// the other outputs and all target outputs not set to off are excluded. It
+// returns nil if none of the outputs has a power state.
+func KScreenDoctorDpmsArgs(targetOutputs []Target, otherOutputs []string) []string {
+	var off, on bool
+	for _, output := range targetOutputs {
+		off = off || output.Dpms == "off"
+		on = on || output.Dpms == "on"
+	}
+	if !off {
+		if on {
+			return []string{"--dpms", "on"}
+		}
+		return nil
+	}
+
+	args := []string{"--dpms", "off"}
+	for _, output := range targetOutputs {
+		if output.Dpms != "off" {
+			args = append(args, "--dpms-excluded", output.Name)
+		}
+	}
+	for _, name := range otherOutputs {
+		args = append(args, "--dpms-excluded", name)
+	}
+	return args
+}
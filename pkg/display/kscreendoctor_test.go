@@ -0,0 +1,26 @@
+package display
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestKScreenDoctorArgsScale(t *testing.T) {
+	tests := []struct {
+		scale float64
+		want  string
+	}{
+		{1.0, "output.DP-1.scale.1"},
+		{1.25, "output.DP-1.scale.1.25"},
+		{1.5, "output.DP-1.scale.1.5"},
+		{2, "output.DP-1.scale.2"},
+		{1.1, "output.DP-1.scale.1.1"},
+	}
+	for _, test := range tests {
+		args := KScreenDoctorArgs([]Target{{Name: "DP-1", Scale: FormatScale(test.scale)}}, nil)
+		want := []string{"output.DP-1.enable", test.want}
+		if !slices.Equal(args, want) {
+			t.Errorf("scale %v: got args %q, want %q", test.scale, args, want)
+		}
+	}
+}
@@ -0,0 +1,534 @@
+package display
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// LoadOptions controls how a profile is mapped onto the current setup.
+type LoadOptions struct {
+	// RefreshTolerance is the maximum deviation from the recorded refresh
+	// rate in Hz.
+	RefreshTolerance float64
+	// SkipMissing skips screens whose output isn't connected instead of
+	// failing.
+	SkipMissing bool
+	// LeaveUnlisted only disables outputs the profile explicitly disables.
+	LeaveUnlisted bool
+	// Realign keeps touching screens edge-aligned if their applied size
+	// differs from the profile.
+	Realign bool
+	// IntegerScale rounds fractional scales to the nearest integer.
+	IntegerScale bool
+	// DisablePatterns and KeepPatterns select outputs by name that are
+	// disabled or left enabled regardless of the profile.
+	DisablePatterns []string
+	KeepPatterns    []string
+	// BestFit falls back to the available resolution closest to the
+	// recorded one if an output doesn't support it.
+	BestFit bool
+	// CheckDPI warns about screens whose scale results in an unusually
+	// small or large effective DPI on the connected monitor.
+	CheckDPI bool
+	// Remap renames outputs referenced by the profile before matching it
+	// against the current setup, e.g. after a monitor moved to another
+	// connector.
+	Remap map[string]string
+	// Only restricts loading to the screens of these outputs and leaves all
+	// other outputs untouched.
+	Only []string
+	// AllowBlackout applies profiles even if they leave no output enabled.
+	AllowBlackout bool
+	// AllowGaps skips the warning about screens that don't touch the rest
+	// of the layout.
+	AllowGaps bool
+
+	// Logger receives warnings, e.g. about skipped outputs. Nothing is
+	// logged if it is nil.
+	Logger *slog.Logger
+}
+
+// orDiscard returns the logger, or one discarding everything if it is nil.
+func orDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return logger
+}
+
+// matchesAny reports whether the name matches one of the patterns.
+func matchesAny(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+// Load maps the profile onto the current setup and returns the outputs to
+// configure and the outputs to disable. All problems found along the way are
+// reported together.
+func Load(profile Profile, currentScreen KScreenDoctorResult, opts LoadOptions) ([]Target, []string, error) {
+	outputByName := lo.Associate(currentScreen.Outputs, func(output Output) (string, Output) {
+		return output.Name, output
+	})
+
+	if len(opts.Remap) > 0 {
+		profile.Screens = remapScreens(profile.Screens, opts.Remap)
+	}
+
+	var errs []error
+	if len(opts.Only) > 0 {
+		for _, name := range opts.Only {
+			if !slices.ContainsFunc(profile.Screens, func(screen Screen) bool { return screen.Name == name }) {
+				errs = append(errs, fmt.Errorf("profile has no screen %s", name))
+			}
+		}
+		profile.Screens = lo.Filter(profile.Screens, func(screen Screen, _ int) bool {
+			return slices.Contains(opts.Only, screen.Name)
+		})
+		opts.LeaveUnlisted = true
+		// The rest of the layout is unknown.
+		opts.AllowGaps = true
+	}
+
+	var targetOutputs []Target
+	var targetOutputNames = make(map[string]bool)
+	var explicitlyDisabled = make(map[string]bool)
+	// The recorded and the actually applied geometry of each target output.
+	var recordedScreens, appliedScreens []Screen
+	var seenScreens = make(map[string]bool)
+	for _, desiredScreen := range profile.Screens {
+		// Hand-edited profiles might list an output twice, which would
+		// result in conflicting arguments.
+		if seenScreens[desiredScreen.Name] {
+			errs = append(errs, &OutputError{
+				Output: desiredScreen.Name,
+				Err:    fmt.Errorf("profile lists output %s more than once", desiredScreen.Name),
+			})
+			continue
+		}
+		seenScreens[desiredScreen.Name] = true
+
+		if !desiredScreen.IsEnabled() {
+			// Missing outputs are off anyway.
+			if output, exists := FindOutput(currentScreen.Outputs, outputByName, desiredScreen); exists {
+				explicitlyDisabled[output.Name] = true
+			}
+			continue
+		}
+
+		var targetOutput Target
+		targetOutput.Scale = FormatScale(desiredScreen.Scale)
+		targetOutput.Position = desiredScreen.Position.String()
+		targetOutput.Priority = desiredScreen.Priority
+		targetOutput.Primary = desiredScreen.Primary
+		targetOutput.VrrPolicy = desiredScreen.VrrPolicy
+		targetOutput.Dpms = desiredScreen.Dpms
+		targetOutput.ColorProfile = desiredScreen.ColorProfile
+		targetOutput.Overscan = desiredScreen.Overscan
+		if profile.Version >= 2 {
+			targetOutput.Hdr = enableDisable(desiredScreen.Hdr)
+			targetOutput.Wcg = enableDisable(desiredScreen.Wcg)
+		}
+		targetOutput.Rotation = desiredScreen.Rotation
+		if targetOutput.Rotation == "" {
+			targetOutput.Rotation = RotationNone.String()
+		}
+
+		if desiredScreen.Dpms != "" && desiredScreen.Dpms != "on" && desiredScreen.Dpms != "off" {
+			errs = append(errs, fmt.Errorf("invalid power state %q for output %s, expected on or off", desiredScreen.Dpms, desiredScreen.Name))
+			continue
+		}
+
+		targetRefreshRate, err := refreshRateTarget(desiredScreen)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		output, exists := FindOutput(currentScreen.Outputs, outputByName, desiredScreen)
+		if !exists && opts.SkipMissing {
+			orDiscard(opts.Logger).Warn("skipping missing output", "output", desiredScreen.Name)
+			continue
+		}
+		if !exists {
+			errs = append(errs, &OutputError{
+				Output: desiredScreen.Name,
+				Err:    fmt.Errorf("profile references %w %s", ErrOutputMissing, desiredScreen.Label()),
+			})
+			continue
+		}
+		if targetOutputNames[output.Name] {
+			errs = append(errs, &OutputError{
+				Output: output.Name,
+				Err:    fmt.Errorf("profile maps more than one screen to output %s", output.Name),
+			})
+			continue
+		}
+		targetOutput.Name = output.Name
+
+		potentialModes := lo.Filter(output.Modes, func(mode Mode, _ int) bool {
+			return mode.Size == desiredScreen.Size
+		})
+		if len(potentialModes) == 0 && opts.BestFit && len(output.Modes) > 0 {
+			size := closestSize(output.Modes, desiredScreen.Size)
+			orDiscard(opts.Logger).Warn("using closest available resolution", "output", desiredScreen.Name,
+				"recorded", fmt.Sprintf("%dx%d", desiredScreen.Size.Width, desiredScreen.Size.Height),
+				"using", fmt.Sprintf("%dx%d", size.Width, size.Height))
+			potentialModes = lo.Filter(output.Modes, func(mode Mode, _ int) bool {
+				return mode.Size == size
+			})
+		}
+		if len(potentialModes) == 0 {
+			errs = append(errs, &OutputError{
+				Output: desiredScreen.Name,
+				Err: fmt.Errorf("output %s has %w for %dx%d (available: %s)",
+					desiredScreen.Name, ErrNoMatchingMode, desiredScreen.Size.Width, desiredScreen.Size.Height, availableSizes(output.Modes)),
+			})
+			continue
+		}
+		switch refreshStrategy(desiredScreen) {
+		case "max":
+			slices.SortFunc(potentialModes, func(a, b Mode) int {
+				return cmp.Compare(b.RefreshRate, a.RefreshRate)
+			})
+		case "min":
+			slices.SortFunc(potentialModes, func(a, b Mode) int {
+				return cmp.Compare(a.RefreshRate, b.RefreshRate)
+			})
+		default:
+			// Pick the mode with the next best refreshrate
+			slices.SortFunc(potentialModes, func(a, b Mode) int {
+				diffA := math.Abs(targetRefreshRate - a.RefreshRate)
+				diffB := math.Abs(targetRefreshRate - b.RefreshRate)
+
+				return cmp.Compare(diffA, diffB)
+			})
+			if diff := math.Abs(targetRefreshRate - potentialModes[0].RefreshRate); diff > opts.RefreshTolerance {
+				errs = append(errs, &OutputError{
+					Output: desiredScreen.Name,
+					Err: fmt.Errorf("output %s has %w for %.2f Hz (closest is %.2f Hz)",
+						desiredScreen.Name, ErrNoMatchingMode, targetRefreshRate, potentialModes[0].RefreshRate),
+				})
+				continue
+			}
+		}
+		targetOutput.Mode = potentialModes[0].Name
+		targetOutput.FallbackMode = ExplicitModeName(potentialModes[0])
+
+		appliedScreen := desiredScreen
+		appliedScreen.Size = potentialModes[0].Size
+		if opts.IntegerScale && desiredScreen.Scale != math.Trunc(desiredScreen.Scale) {
+			appliedScreen.Scale = max(1, math.Round(desiredScreen.Scale))
+			orDiscard(opts.Logger).Warn("rounding fractional scale", "output", desiredScreen.Name, "scale", desiredScreen.Scale, "rounded", appliedScreen.Scale)
+			targetOutput.Scale = FormatScale(appliedScreen.Scale)
+		}
+		if opts.CheckDPI {
+			checkDPI(output, appliedScreen, orDiscard(opts.Logger))
+		}
+		recordedScreens = append(recordedScreens, desiredScreen)
+		appliedScreens = append(appliedScreens, appliedScreen)
+
+		targetOutputs = append(targetOutputs, targetOutput)
+		targetOutputNames[targetOutput.Name] = true
+	}
+
+	positions := lo.Map(appliedScreens, func(screen Screen, _ int) Position {
+		return screen.Position
+	})
+	if opts.Realign {
+		positions = alignPositions(recordedScreens, appliedScreens)
+	}
+	resolveRelativePositions(appliedScreens, positions)
+	for i, position := range positions {
+		targetOutputs[i].Position = position.String()
+	}
+
+	// Mirrored outputs have to cover exactly the area of their source, as
+	// that is how cloning is expressed to the compositor.
+	for i, screen := range appliedScreens {
+		if screen.Mirror == "" {
+			continue
+		}
+		j := slices.IndexFunc(appliedScreens, func(source Screen) bool {
+			return source.Name == screen.Mirror
+		})
+		if j < 0 {
+			if !opts.SkipMissing {
+				errs = append(errs, fmt.Errorf("output %s mirrors %s, which the profile doesn't enable", screen.Name, screen.Mirror))
+			}
+			continue
+		}
+		if size, sourceSize := LogicalSize(screen), LogicalSize(appliedScreens[j]); size != sourceSize {
+			errs = append(errs, fmt.Errorf("output %s can't mirror %s, it would cover %dx%d instead of %dx%d",
+				screen.Name, screen.Mirror, size.Width, size.Height, sourceSize.Width, sourceSize.Height))
+			continue
+		}
+		targetOutputs[i].Position = targetOutputs[j].Position
+		positions[i] = positions[j]
+	}
+
+	// Compositors without per-output scaling, like X11, apply a single
+	// scale to all outputs.
+	if scales := lo.Uniq(lo.Map(targetOutputs, func(output Target, _ int) string {
+		return output.Scale
+	})); len(scales) > 1 && !currentScreen.Supports(FeaturePerOutputScaling) {
+		orDiscard(opts.Logger).Warn("compositor doesn't support a scale per output", "scales", scales)
+	}
+
+	// The cursor can't cross from one region of the layout to another, so
+	// screens placed off on their own are likely a mistake.
+	if regions := layoutRegions(appliedScreens, positions); len(regions) > 1 && !opts.AllowGaps {
+		orDiscard(opts.Logger).Warn("layout has screens that don't touch each other", "regions", regions)
+	}
+
+	if primaries := lo.Filter(targetOutputs, func(output Target, _ int) bool { return output.Primary }); len(primaries) > 1 {
+		errs = append(errs, fmt.Errorf("profile marks more than one screen as primary: %s",
+			strings.Join(lo.Map(primaries, func(output Target, _ int) string { return output.Name }), ", ")))
+	}
+
+	// Renumber the priorities starting at 1 (the primary display). Profiles
+	// without priorities keep the order they were saved in. A screen marked
+	// as primary comes first.
+	slices.SortStableFunc(targetOutputs, func(a, b Target) int {
+		if a.Primary != b.Primary {
+			if a.Primary {
+				return -1
+			}
+			return 1
+		}
+		return a.Priority - b.Priority
+	})
+	for i := range targetOutputs {
+		targetOutputs[i].Priority = i + 1
+		// Priorities are relative to the outputs left untouched.
+		if len(opts.Only) > 0 {
+			targetOutputs[i].Priority = 0
+		}
+	}
+
+	var disabledOutputs []string
+	for outputName := range outputByName {
+		if targetOutputNames[outputName] {
+			continue
+		}
+		if matchesAny(opts.KeepPatterns, outputName) {
+			continue
+		}
+		if opts.LeaveUnlisted && !explicitlyDisabled[outputName] && !matchesAny(opts.DisablePatterns, outputName) {
+			continue
+		}
+		disabledOutputs = append(disabledOutputs, outputName)
+	}
+	// Map iteration order is random; keep the arguments reproducible.
+	slices.Sort(disabledOutputs)
+
+	// Without any enabled output, there's no way to fix things on screen.
+	stillEnabled := slices.ContainsFunc(currentScreen.Outputs, func(output Output) bool {
+		return output.Enabled && !slices.Contains(disabledOutputs, output.Name)
+	})
+	if len(errs) == 0 && len(targetOutputs) == 0 && !stillEnabled && !opts.AllowBlackout {
+		errs = append(errs, ErrNoOutputEnabled)
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	return targetOutputs, disabledOutputs, nil
+}
+
+// Target describes the desired state of a single output. Empty properties
+// are left untouched.
+type Target struct {
+	Name      string
+	Mode      string
+	Position  string
+	Scale     string
+	Rotation  string
+	Priority  int
+	Primary   bool
+	VrrPolicy string
+	Hdr       string
+	Wcg       string
+	Overscan  int
+	Dpms      string
+	// ColorProfile is the path to an ICC profile.
+	ColorProfile string
+
+	// FallbackMode spells out the mode's geometry in case the backend
+	// doesn't understand the mode name.
+	FallbackMode string
+}
+
+// remapScreens returns a copy of the screens with the output names, and the
+// references to them, renamed according to the mapping.
+func remapScreens(screens []Screen, mapping map[string]string) []Screen {
+	rename := func(name string) string {
+		if newName, ok := mapping[name]; ok {
+			return newName
+		}
+		return name
+	}
+
+	remapped := slices.Clone(screens)
+	for i := range remapped {
+		screen := &remapped[i]
+		screen.Name = rename(screen.Name)
+		if screen.Mirror != "" {
+			screen.Mirror = rename(screen.Mirror)
+		}
+		if screen.Relative != nil {
+			relative := *screen.Relative
+			relative.To = rename(relative.To)
+			screen.Relative = &relative
+		}
+		// The EDID belongs to the monitor previously found under the old
+		// name, so match by name only.
+		if screen.Name != screens[i].Name {
+			screen.Edid = Edid{}
+		}
+	}
+	return remapped
+}
+
+// refreshStrategy returns the strategy picking the screen's refresh rate.
+// Screens without a refresh rate, e.g. because it couldn't be determined
+// when saving, get the highest one available.
+func refreshStrategy(screen Screen) string {
+	if (screen.RefreshStrategy == "" || screen.RefreshStrategy == "exact") && screen.RefreshRate == 0 {
+		return "max"
+	}
+	return screen.RefreshStrategy
+}
+
+// refreshRateTarget returns the refresh rate the screen's strategy aims for.
+// It is 0 for strategies picking the highest or lowest rate.
+func refreshRateTarget(screen Screen) (float64, error) {
+	switch refreshStrategy(screen) {
+	case "", "exact":
+		return screen.RefreshRate, nil
+	case "max", "min":
+		return 0, nil
+	}
+
+	refreshRate, err := strconv.ParseFloat(screen.RefreshStrategy, 64)
+	if err != nil || refreshRate <= 0 {
+		return 0, fmt.Errorf("invalid refresh strategy %q for output %s, expected exact, max, min or a rate in Hz", screen.RefreshStrategy, screen.Name)
+	}
+	return refreshRate, nil
+}
+
+// closestSize returns the size of the modes best matching the desired size,
+// preferring the same aspect ratio over a similar number of pixels.
+func closestSize(modes []Mode, desired Size) Size {
+	aspectRatio := func(size Size) float64 {
+		return float64(size.Width) / float64(max(1, size.Height))
+	}
+	pixels := func(size Size) int {
+		return size.Width * size.Height
+	}
+	// Ratios like 16:9 and 1366x768 only match approximately.
+	aspectDistance := func(size Size) float64 {
+		return math.Round(math.Abs(aspectRatio(size)-aspectRatio(desired)) * 100)
+	}
+
+	best := slices.MinFunc(modes, func(a, b Mode) int {
+		return cmp.Or(
+			cmp.Compare(aspectDistance(a.Size), aspectDistance(b.Size)),
+			cmp.Compare(abs(pixels(a.Size)-pixels(desired)), abs(pixels(b.Size)-pixels(desired))),
+		)
+	})
+	return best.Size
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// availableSizes lists the distinct sizes of the modes, e.g. to point out
+// alternatives to a size that isn't supported.
+func availableSizes(modes []Mode) string {
+	sizes := lo.Uniq(lo.Map(modes, func(mode Mode, _ int) string {
+		return fmt.Sprintf("%dx%d", mode.Size.Width, mode.Size.Height)
+	}))
+	if len(sizes) == 0 {
+		return "none"
+	}
+	return strings.Join(sizes, ", ")
+}
+
+// ExplicitModeName describes a mode as <width>x<height>@<refresh>.
+func ExplicitModeName(mode Mode) string {
+	return fmt.Sprintf("%dx%d@%d", mode.Size.Width, mode.Size.Height, int(math.Round(mode.RefreshRate)))
+}
+
+// WithFallbackModes returns a copy of the target outputs using their fallback
+// modes, and whether any of them has one differing from its mode.
+func WithFallbackModes(targetOutputs []Target) ([]Target, bool) {
+	fallbackOutputs := slices.Clone(targetOutputs)
+	var changed bool
+	for i, output := range fallbackOutputs {
+		if output.FallbackMode != "" && output.FallbackMode != output.Mode {
+			fallbackOutputs[i].Mode = output.FallbackMode
+			changed = true
+		}
+	}
+	return fallbackOutputs, changed
+}
+
+// FormatScale formats a scale factor as short as possible, so 1.25 stays
+// 1.25 and 1.0 becomes 1.
+func FormatScale(scale float64) string {
+	return strconv.FormatFloat(scale, 'f', -1, 64)
+}
+
+// enableDisable translates an optional flag into kscreen-doctor's
+// enable/disable keywords. Unset flags result in an empty string.
+func enableDisable(flag *bool) string {
+	switch {
+	case flag == nil:
+		return ""
+	case *flag:
+		return "enable"
+	default:
+		return "disable"
+	}
+}
+
+// CurrentRefreshRate returns the refresh rate of the output's current mode,
+// or 0 if it can't be determined.
+func CurrentRefreshRate(output Output) float64 {
+	for _, mode := range output.Modes {
+		if mode.Id == output.CurrentModeId {
+			return mode.RefreshRate
+		}
+	}
+	return 0
+}
+
+// FindOutput looks up the output a screen refers to, first by connector
+// name and then by EDID.
+func FindOutput(outputs []Output, outputByName map[string]Output, screen Screen) (Output, bool) {
+	output, exists := outputByName[screen.Name]
+	if !exists && !screen.Edid.IsZero() {
+		// The monitor might be connected to a different port now.
+		output, exists = lo.Find(outputs, func(output Output) bool {
+			return output.Edid == screen.Edid
+		})
+	}
+	return output, exists
+}
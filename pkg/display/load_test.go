@@ -0,0 +1,160 @@
+package display
+
+import (
+	"cmp"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+)
+
+// readDump reads a recorded kscreen-doctor --json dump from testdata.
+func readDump(t *testing.T, name string) KScreenDoctorResult {
+	t.Helper()
+	b, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := DecodeKScreenDoctor(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// loadArgs saves the setup of the dump, lets modify change the profile and
+// returns the kscreen-doctor args loading it onto the same setup.
+func loadArgs(t *testing.T, modify func(*Profile), opts LoadOptions) ([]string, error) {
+	t.Helper()
+	setup := readDump(t, "docked.json")
+	profile, err := Save(setup, SaveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modify != nil {
+		modify(&profile)
+	}
+	targetOutputs, disabledOutputs, err := Load(profile, setup, opts)
+	if err != nil {
+		return nil, err
+	}
+	return KScreenDoctorArgs(targetOutputs, disabledOutputs), nil
+}
+
+func TestLoadSavedSetup(t *testing.T) {
+	args, err := loadArgs(t, nil, LoadOptions{RefreshTolerance: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"output.DP-2.disable",
+		"output.HDMI-A-1.disable",
+		"output.DP-1.enable",
+		"output.DP-1.mode.2560x1440@144",
+		"output.DP-1.position.0,0",
+		"output.DP-1.scale.1",
+		"output.DP-1.rotation.normal",
+		"output.DP-1.priority.1",
+		"output.DP-1.vrrpolicy.automatic",
+		"output.DP-1.hdr.disable",
+		"output.DP-1.wcg.disable",
+		"output.eDP-1.enable",
+		"output.eDP-1.mode.1920x1200@60",
+		"output.eDP-1.position.2560,240",
+		"output.eDP-1.scale.1.25",
+		"output.eDP-1.rotation.normal",
+		"output.eDP-1.priority.2",
+		"output.eDP-1.vrrpolicy.never",
+	}
+	if !slices.Equal(args, want) {
+		t.Errorf("got args\n%q\nwant\n%q", args, want)
+	}
+}
+
+func TestLoadDisablesUnlistedOutputs(t *testing.T) {
+	onlyLaptop := func(profile *Profile) {
+		profile.Screens = slices.DeleteFunc(profile.Screens, func(screen Screen) bool {
+			return screen.Name != "eDP-1"
+		})
+	}
+
+	args, err := loadArgs(t, onlyLaptop, LoadOptions{RefreshTolerance: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, arg := range []string{"output.DP-1.disable", "output.HDMI-A-1.disable", "output.eDP-1.enable"} {
+		if !slices.Contains(args, arg) {
+			t.Errorf("args %q lack %s", args, arg)
+		}
+	}
+
+	args, err = loadArgs(t, onlyLaptop, LoadOptions{RefreshTolerance: 1, LeaveUnlisted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(args, "output.DP-1.disable") {
+		t.Errorf("args %q disable DP-1 despite LeaveUnlisted", args)
+	}
+}
+
+func TestLoadModeMatching(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string // DP-1 if empty
+		refreshRate float64
+		strategy    string
+		tolerance   float64
+		wantMode    string
+		wantErr     error
+	}{
+		{name: "recorded rate", refreshRate: 143.998, tolerance: 1, wantMode: "2560x1440@144"},
+		// eDP-1 offers both 59.94 and 60.001 Hz at the same size.
+		{name: "fractional rate below", output: "eDP-1", refreshRate: 59.95, tolerance: 1, wantMode: "1920x1200@59.94"},
+		{name: "fractional rate above", output: "eDP-1", refreshRate: 60, tolerance: 1, wantMode: "1920x1200@60"},
+		{name: "rounded rate", refreshRate: 60, tolerance: 1, wantMode: "2560x1440@60"},
+		{name: "outside tolerance", refreshRate: 120, tolerance: 1, wantErr: ErrNoMatchingMode},
+		{name: "unknown rate", refreshRate: 0, tolerance: 1, wantMode: "2560x1440@144"},
+		{name: "min strategy", refreshRate: 143.998, strategy: "min", tolerance: 1, wantMode: "2560x1440@60"},
+		{name: "rate strategy", refreshRate: 143.998, strategy: "60", tolerance: 1, wantMode: "2560x1440@60"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := cmp.Or(test.output, "DP-1")
+			args, err := loadArgs(t, func(profile *Profile) {
+				i := slices.IndexFunc(profile.Screens, func(screen Screen) bool { return screen.Name == output })
+				profile.Screens[i].RefreshRate = test.refreshRate
+				profile.Screens[i].RefreshStrategy = test.strategy
+			}, LoadOptions{RefreshTolerance: test.tolerance})
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("got error %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if arg := "output." + output + ".mode." + test.wantMode; !slices.Contains(args, arg) {
+				t.Errorf("args %q lack %s", args, arg)
+			}
+		})
+	}
+}
+
+func TestSaveKeepsSetup(t *testing.T) {
+	setup := readDump(t, "docked.json")
+	names := func() []string {
+		var names []string
+		for _, output := range setup.Outputs {
+			names = append(names, output.Name)
+		}
+		return names
+	}
+	before := names()
+	if _, err := Save(setup, SaveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if after := names(); !slices.Equal(after, before) {
+		t.Errorf("Save reordered the outputs of the setup from %q to %q", before, after)
+	}
+}
@@ -0,0 +1,84 @@
+package display
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/samber/lo"
+)
+
+// SaveOptions controls how a setup is turned into a profile.
+type SaveOptions struct {
+	// Strict fails if the refresh rate of an output can't be determined,
+	// instead of recording it as 0.
+	Strict bool
+	// Logger receives warnings. Nothing is logged if it is nil.
+	Logger *slog.Logger
+}
+
+// Save turns the screen setup into a profile containing all enabled outputs,
+// ordered by priority. Disabled but connected outputs are recorded as
+// disabled.
+func Save(result KScreenDoctorResult, opts SaveOptions) (Profile, error) {
+	// Sort by priority, leaving the caller's setup untouched.
+	outputs := slices.Clone(result.Outputs)
+	slices.SortFunc(outputs, func(a, b Output) int {
+		return a.Priority - b.Priority
+	})
+
+	profile := Profile{Version: ProfileVersion}
+	var disabledScreens []Screen
+	for _, output := range outputs {
+		if !output.Enabled {
+			if output.Connected {
+				disabledScreens = append(disabledScreens, Screen{
+					Name:        output.Name,
+					Edid:        output.Edid,
+					Enabled:     lo.ToPtr(false),
+					Description: output.Describe(),
+				})
+			}
+			continue
+		}
+
+		var screen Screen
+		screen.Name = output.Name
+		screen.Size = output.Size
+		screen.Position = output.Pos
+		screen.Scale = output.Scale
+		screen.Edid = output.Edid
+		screen.Rotation = output.Rotation.String()
+		screen.Priority = output.Priority
+		if output.VrrPolicy != nil {
+			screen.VrrPolicy = output.VrrPolicy.String()
+		}
+		screen.Hdr = output.Hdr
+		screen.Wcg = output.Wcg
+		screen.Overscan = output.Overscan
+		screen.ColorProfile = output.IccProfilePath
+		screen.Description = output.Describe()
+
+		screen.RefreshRate = CurrentRefreshRate(output)
+
+		if screen.RefreshRate == 0 {
+			if opts.Strict {
+				return Profile{}, fmt.Errorf("failed to determine refreshrate for output %s (mode %q)", output.Name, output.CurrentModeId)
+			}
+			orDiscard(opts.Logger).Warn("failed to determine refreshrate, recording it as 0 to use the highest one when loading",
+				"output", output.Name, "mode", output.CurrentModeId)
+		}
+
+		// Outputs covering the same area are clones of each other.
+		if source, found := lo.Find(profile.Screens, func(other Screen) bool {
+			return other.Position == screen.Position && LogicalSize(other) == LogicalSize(screen)
+		}); found {
+			screen.Mirror = source.Name
+		}
+
+		profile.Screens = append(profile.Screens, screen)
+	}
+	profile.Screens = append(profile.Screens, disabledScreens...)
+
+	return profile, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+// maxRemoteProfileSize is the largest profile accepted from a URL. Even
+// profiles with many outputs stay far below it.
+const maxRemoteProfileSize = 1 << 20
+
+// isProfileURL reports whether the profile name is an http(s) URL.
+func isProfileURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// fetchProfile downloads and parses the profile at the given URL. Hooks are
+// dropped, since they would run commands from whoever serves the profile.
+func fetchProfile(ctx context.Context, logger *slog.Logger, url string, timeout time.Duration) (display.Profile, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return display.Profile{}, fmt.Errorf("invalid profile URL: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return display.Profile{}, fmt.Errorf("failed to fetch profile: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return display.Profile{}, fmt.Errorf("%w: %s", ErrProfileNotFound, url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return display.Profile{}, fmt.Errorf("failed to fetch profile: %s", resp.Status)
+	}
+	// Raw file hosts commonly serve JSON as plain text.
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") && mediaType != "text/plain") {
+		return display.Profile{}, fmt.Errorf("failed to fetch profile: unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	if resp.ContentLength > maxRemoteProfileSize {
+		return display.Profile{}, fmt.Errorf("failed to fetch profile: %d bytes exceed the limit of %d", resp.ContentLength, maxRemoteProfileSize)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteProfileSize+1))
+	if err != nil {
+		return display.Profile{}, fmt.Errorf("failed to fetch profile: %w", err)
+	}
+	if len(b) > maxRemoteProfileSize {
+		return display.Profile{}, fmt.Errorf("failed to fetch profile: it exceeds the limit of %d bytes", maxRemoteProfileSize)
+	}
+
+	var profile display.Profile
+	if err := decodeProfileJSON(b, &profile); err != nil {
+		return display.Profile{}, fmt.Errorf("failed to deserialize profile: %w", err)
+	}
+	if profile.PreApply != "" || profile.PostApply != "" {
+		logger.Warn("ignoring hooks of remote profile", "url", url)
+		profile.PreApply, profile.PostApply = "", ""
+	}
+	return profile, nil
+}
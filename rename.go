@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type RenameProfileCmd struct {
+	Old   string `arg:"1" predictor:"profile" help:"The current name of the profile or a path to the profile file."`
+	New   string `arg:"1" help:"The new name of the profile or a path to the profile file."`
+	Force bool   `short:"f" help:"Overwrite an existing profile with the new name."`
+}
+
+func (cmd RenameProfileCmd) Run() error {
+	if inStore(cmd.Old) || inStore(cmd.New) {
+		return cmd.moveProfile()
+	}
+
+	oldPath, err := profilePath(cmd.Old)
+	if err != nil {
+		return err
+	}
+	newPath, err := profilePath(cmd.New)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(oldPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrProfileNotFound, cmd.Old)
+		}
+		return fmt.Errorf("failed to access profile: %w", err)
+	}
+	if !cmd.Force {
+		if _, err := os.Stat(newPath); err == nil {
+			return fmt.Errorf("profile %s already exists", cmd.New)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to access profile: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("failed to rename profile: %w", err)
+	}
+
+	return nil
+}
+
+// moveProfile renames a profile kept in the store file, or moves it between
+// the store file and a file of its own.
+func (cmd RenameProfileCmd) moveProfile() error {
+	profile, err := readProfile(cmd.Old)
+	if err != nil {
+		return err
+	}
+	if !cmd.Force {
+		exists, err := profileExists(cmd.New)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("profile %s already exists", cmd.New)
+		}
+	}
+
+	if err := writeProfile(cmd.New, profile); err != nil {
+		return err
+	}
+	return deleteProfile(cmd.Old)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+type ScaleCmd struct {
+	Scale    float64 `arg:"1" help:"The scale to set on all enabled outputs, e.g. 1.5."`
+	DryRun   bool    `help:"Print the kscreen-doctor command instead of running it."`
+	NoBackup bool    `help:"Don't save the current setup as profile ${backup_profile} before scaling."`
+}
+
+func (cmd ScaleCmd) Run(globals *Globals) error {
+	if cmd.Scale <= 0 {
+		return fmt.Errorf("invalid scale %g", cmd.Scale)
+	}
+
+	currentScreen, err := currentScreenSetup(globals)
+	if err != nil {
+		return fmt.Errorf("failed to load current screen setup: %w", err)
+	}
+
+	// Only the scale is set, so modes and positions stay as they are.
+	var targetOutputs []display.Target
+	for _, output := range currentScreen.Outputs {
+		if !output.Enabled {
+			continue
+		}
+		targetOutputs = append(targetOutputs, display.Target{
+			Name:  output.Name,
+			Scale: display.FormatScale(cmd.Scale),
+		})
+	}
+	if len(targetOutputs) == 0 {
+		return errors.New("no output is enabled")
+	}
+
+	// Allows reverting with undo, e.g. after a presentation.
+	if !cmd.DryRun && !cmd.NoBackup {
+		if err := backupSetup(globals, currentScreen); err != nil {
+			return err
+		}
+	}
+
+	return applyOutputs(globals, targetOutputs, nil, cmd.DryRun)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+	"github.com/invopop/jsonschema"
+)
+
+type SchemaCmd struct{}
+
+func (cmd SchemaCmd) Run() error {
+	reflector := jsonschema.Reflector{ExpandedStruct: true}
+	schema := reflector.Reflect(&display.Profile{})
+	schema.Title = "kdedisplayprofile profile"
+
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize schema: %w", err)
+	}
+	fmt.Println(string(b))
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+type SetCmd struct {
+	Name   string `arg:"1" predictor:"profile" help:"The name of the profile or a path to the profile file."`
+	Output string `required:"" placeholder:"NAME" help:"The output of the profile to change."`
+
+	Scale       float64 `help:"Set the scale of the output."`
+	RefreshRate float64 `placeholder:"HZ" help:"Set the refresh rate of the output."`
+	Position    string  `placeholder:"X,Y" help:"Set the position of the output."`
+	Rotation    string  `help:"Set the rotation of the output (normal, left, inverted or right)."`
+}
+
+func (cmd SetCmd) Run() error {
+	if cmd.Scale == 0 && cmd.RefreshRate == 0 && cmd.Position == "" && cmd.Rotation == "" {
+		return errors.New("nothing to change, use --scale, --refresh-rate, --position or --rotation")
+	}
+	if cmd.Scale < 0 {
+		return fmt.Errorf("invalid scale %g", cmd.Scale)
+	}
+	if cmd.RefreshRate < 0 {
+		return fmt.Errorf("invalid refresh rate %g", cmd.RefreshRate)
+	}
+	var position display.Position
+	if cmd.Position != "" {
+		var err error
+		if position, err = display.ParsePosition(cmd.Position); err != nil {
+			return err
+		}
+	}
+	if cmd.Rotation != "" && !slices.Contains([]string{"normal", "left", "inverted", "right"}, cmd.Rotation) {
+		return fmt.Errorf("invalid rotation %q", cmd.Rotation)
+	}
+
+	name, err := resolveProfileName(cmd.Name)
+	if err != nil {
+		return err
+	}
+	profile, err := readProfile(name)
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(profile.Screens, func(screen display.Screen) bool {
+		return screen.Name == cmd.Output
+	})
+	if i < 0 {
+		return &display.OutputError{
+			Output: cmd.Output,
+			Err:    fmt.Errorf("profile %s has no output %s", name, cmd.Output),
+		}
+	}
+	screen := &profile.Screens[i]
+	if !screen.IsEnabled() {
+		return fmt.Errorf("output %s is disabled in profile %s", cmd.Output, name)
+	}
+
+	if cmd.Scale != 0 {
+		screen.Scale = cmd.Scale
+	}
+	if cmd.RefreshRate != 0 {
+		screen.RefreshRate = cmd.RefreshRate
+	}
+	if cmd.Position != "" {
+		screen.Position = position
+		screen.Relative = nil
+	}
+	if cmd.Rotation != "" {
+		screen.Rotation = cmd.Rotation
+	}
+
+	return writeProfile(name, profile)
+}
@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+
+type StatusCmd struct {
+	Unsaved string `default:"unsaved layout" help:"Text printed if no saved profile matches the current setup."`
+
+	RefreshTolerance float64 `default:"1.0" placeholder:"HZ" help:"Maximum deviation from the recorded refresh rate."`
+}
+
+func (cmd StatusCmd) Run(globals *Globals) error {
+	currentScreen, err := currentScreenSetup(globals)
+	if err != nil {
+		return fmt.Errorf("failed to load current screen setup: %w", err)
+	}
+
+	names, err := profileNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		profile, err := readProfile(name)
+		if err != nil {
+			globals.log().Warn("skipping profile", "profile", name, "error", err)
+			continue
+		}
+		if allMatch(diffProfile(profile, currentScreen, cmd.RefreshTolerance)) {
+			fmt.Println(name)
+			return nil
+		}
+	}
+
+	fmt.Println(cmd.Unsaved)
+	return nil
+}
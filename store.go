@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+	"github.com/samber/lo"
+)
+
+// storeFile holds all profiles, keyed by name, if single file storage is
+// selected.
+const storeFile = "profiles.json"
+
+// singleStore selects single file storage instead of a file per profile.
+var singleStore bool
+
+// inStore reports whether the profile with the given name is kept in the
+// store file. Explicit paths always refer to a file of their own.
+func inStore(name string) bool {
+	return singleStore && name != "-" && !strings.ContainsRune(name, '/')
+}
+
+// storePath returns the path of the store file.
+func storePath() (string, error) {
+	dir, err := profilesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, storeFile), nil
+}
+
+// readStore reads all profiles from the store file. A missing store file
+// holds no profiles.
+func readStore() (map[string]display.Profile, error) {
+	path, err := storePath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]display.Profile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile store: %w", err)
+	}
+	profiles := make(map[string]display.Profile)
+	if err := decodeProfileJSON(b, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to deserialize profile store: %w", err)
+	}
+	return profiles, nil
+}
+
+// writeStore replaces the store file with the given profiles.
+func writeStore(profiles map[string]display.Profile) error {
+	b, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize profile store: %w", err)
+	}
+	b = append(b, '\n')
+
+	path, err := storePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	if err := writeFileAtomic(path, b); err != nil {
+		return fmt.Errorf("failed to write profile store: %w", err)
+	}
+	return nil
+}
+
+// storeNames returns the names of all profiles in the store file, leaving out
+// hidden ones like the backup.
+func storeNames() ([]string, error) {
+	profiles, err := readStore()
+	if err != nil {
+		return nil, err
+	}
+	names := lo.Filter(lo.Keys(profiles), func(name string, _ int) bool {
+		return !strings.HasPrefix(name, ".")
+	})
+	slices.Sort(names)
+	return names, nil
+}
+
+// profileExists reports whether a profile with the given name or path exists.
+func profileExists(name string) (bool, error) {
+	if inStore(name) {
+		profiles, err := readStore()
+		if err != nil {
+			return false, err
+		}
+		_, exists := profiles[name]
+		return exists, nil
+	}
+
+	path, err := profilePath(name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to access profile: %w", err)
+	}
+	return true, nil
+}
+
+// deleteProfile removes the profile with the given name or path.
+func deleteProfile(name string) error {
+	if inStore(name) {
+		profiles, err := readStore()
+		if err != nil {
+			return err
+		}
+		if _, exists := profiles[name]; !exists {
+			return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+		}
+		delete(profiles, name)
+		return writeStore(profiles)
+	}
+
+	path, err := profilePath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+		}
+		return fmt.Errorf("failed to delete profile: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a hidden temporary file next to path and
+// renames it into place, so an interrupted write never leaves a truncated
+// file behind.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+type UndoCmd struct {
+	DryRun bool `help:"Print the kscreen-doctor command instead of running it."`
+}
+
+func (cmd UndoCmd) Run(globals *Globals) error {
+	profile, err := readProfile(backupProfile)
+	if errors.Is(err, ErrProfileNotFound) {
+		return fmt.Errorf("%w: no backup exists yet, load a profile first", ErrProfileNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	currentScreen, err := currentScreenSetup(globals)
+	if err != nil {
+		return fmt.Errorf("failed to load current screen setup: %w", err)
+	}
+
+	// Keep the setup being undone, so running undo again restores it.
+	if !cmd.DryRun {
+		if err := backupSetup(globals, currentScreen); err != nil {
+			return err
+		}
+	}
+
+	// Outputs might have been unplugged since the backup was taken.
+	return applyProfile(globals, profile, currentScreen, loadOptions{
+		LoadOptions: display.LoadOptions{
+			RefreshTolerance: 1,
+			SkipMissing:      true,
+		},
+	}, cmd.DryRun)
+}
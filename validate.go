@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+type ValidateCmd struct {
+	Name string `arg:"1" predictor:"profile" help:"The name of the profile or a path to the profile file."`
+
+	RefreshTolerance float64 `default:"1.0" placeholder:"HZ" help:"Maximum deviation from the recorded refresh rate."`
+}
+
+func (cmd ValidateCmd) Run(globals *Globals) error {
+	profile, err := readProfile(cmd.Name)
+	if err != nil {
+		return err
+	}
+	if err := profile.CheckVersion(); err != nil {
+		return err
+	}
+
+	currentScreen, err := currentScreenSetup(globals)
+	if err != nil {
+		return fmt.Errorf("failed to load current screen setup: %w", err)
+	}
+
+	_, _, err = display.Load(profile, currentScreen, display.LoadOptions{
+		RefreshTolerance: cmd.RefreshTolerance,
+		Logger:           globals.log(),
+	})
+	if err == nil {
+		return nil
+	}
+
+	problems := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		problems = joined.Unwrap()
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	return fmt.Errorf("profile %s has %d problem(s)", cmd.Name, len(problems))
+}
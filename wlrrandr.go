@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/aksdb/kdedisplayprofile/pkg/display"
+)
+
+// wlrRandrBackend configures the displays of wlroots based compositors using
+// wlr-randr.
+type wlrRandrBackend struct {
+	globals *Globals
+}
+
+// wlrRandrOutput is a single output as reported by wlr-randr --json.
+type wlrRandrOutput struct {
+	Name         string           `json:"name"`
+	Description  string           `json:"description"`
+	Make         string           `json:"make"`
+	Model        string           `json:"model"`
+	Serial       string           `json:"serial"`
+	Enabled      bool             `json:"enabled"`
+	Modes        []wlrRandrMode   `json:"modes"`
+	Position     display.Position `json:"position"`
+	Transform    string           `json:"transform"`
+	Scale        float64          `json:"scale"`
+	AdaptiveSync bool             `json:"adaptive_sync"`
+}
+
+type wlrRandrMode struct {
+	Width   int     `json:"width"`
+	Height  int     `json:"height"`
+	Refresh float64 `json:"refresh"`
+	Current bool    `json:"current"`
+}
+
+// wlrRandrRotations maps wlr-randr transforms to kscreen rotations.
+var wlrRandrRotations = map[string]display.Rotation{
+	"normal": display.RotationNone,
+	"90":     display.RotationLeft,
+	"180":    display.RotationInverted,
+	"270":    display.RotationRight,
+}
+
+func (b wlrRandrBackend) Name() string {
+	return "wlr-randr"
+}
+
+func (b wlrRandrBackend) path() (string, error) {
+	path, err := lookPath("wlr-randr")
+	if err != nil {
+		return "", fmt.Errorf("wlr-randr not found in PATH")
+	}
+	return path, nil
+}
+
+func (b wlrRandrBackend) CurrentSetup() (display.KScreenDoctorResult, error) {
+	path, err := b.path()
+	if err != nil {
+		return display.KScreenDoctorResult{}, err
+	}
+	output, err := b.globals.runCommand(path, "--json")
+	if err != nil {
+		return display.KScreenDoctorResult{}, err
+	}
+
+	var wlrOutputs []wlrRandrOutput
+	if err := json.Unmarshal(output, &wlrOutputs); err != nil {
+		return display.KScreenDoctorResult{}, fmt.Errorf("failed to decode wlr-randr result: %w", err)
+	}
+
+	// Translate into the kscreen-doctor structure, so the rest of the
+	// program doesn't have to care about the backend.
+	var result display.KScreenDoctorResult
+	for i, wlrOutput := range wlrOutputs {
+		vrrPolicy := display.VrrPolicyNever
+		if wlrOutput.AdaptiveSync {
+			vrrPolicy = display.VrrPolicyAutomatic
+		}
+		output := display.Output{
+			Name:      wlrOutput.Name,
+			Enabled:   wlrOutput.Enabled,
+			Connected: true,
+			Pos:       wlrOutput.Position,
+			Scale:     wlrOutput.Scale,
+			Priority:  i + 1,
+			Edid: display.Edid{
+				Vendor: wlrOutput.Make,
+				Model:  wlrOutput.Model,
+				Serial: wlrOutput.Serial,
+			},
+			Rotation:    wlrRandrRotations[wlrOutput.Transform],
+			VrrPolicy:   &vrrPolicy,
+			Description: wlrOutput.Description,
+		}
+		for j, wlrMode := range wlrOutput.Modes {
+			mode := display.Mode{
+				Id:          strconv.Itoa(j),
+				Name:        fmt.Sprintf("%dx%d@%.3fHz", wlrMode.Width, wlrMode.Height, wlrMode.Refresh),
+				RefreshRate: wlrMode.Refresh,
+				Size:        display.Size{Width: wlrMode.Width, Height: wlrMode.Height},
+			}
+			if wlrMode.Current {
+				output.CurrentModeId = mode.Id
+				output.Size = mode.Size
+			}
+			output.Modes = append(output.Modes, mode)
+		}
+		result.Outputs = append(result.Outputs, output)
+	}
+
+	return result, nil
+}
+
+func (b wlrRandrBackend) BuildArgs(targetOutputs []display.Target, disabledOutputs []string) []string {
+	var args []string
+	for _, outputName := range disabledOutputs {
+		args = append(args, "--output", outputName, "--off")
+	}
+	for _, output := range targetOutputs {
+		args = append(args, "--output", output.Name, "--on")
+		if output.Mode != "" {
+			args = append(args, "--mode", output.Mode)
+		}
+		if output.Position != "" {
+			args = append(args, "--pos", output.Position)
+		}
+		if output.Scale != "" {
+			args = append(args, "--scale", output.Scale)
+		}
+		if output.Rotation != "" {
+			for transform, rotation := range wlrRandrRotations {
+				if rotation.String() == output.Rotation {
+					args = append(args, "--transform", transform)
+					break
+				}
+			}
+		}
+		switch output.VrrPolicy {
+		case "":
+		case display.VrrPolicyNever.String():
+			args = append(args, "--adaptive-sync", "disabled")
+		default:
+			args = append(args, "--adaptive-sync", "enabled")
+		}
+		// wlr-randr has no notion of output priorities, HDR, wide color
+		// gamut or overscan, so those are ignored.
+	}
+	return args
+}
+
+// PowerArgs returns nil, wlr-randr can't switch the power state of outputs.
+func (b wlrRandrBackend) PowerArgs(targetOutputs []display.Target, otherOutputs []string) []string {
+	return nil
+}
+
+func (b wlrRandrBackend) Apply(args ...string) error {
+	path, err := b.path()
+	if err != nil {
+		return err
+	}
+	output, err := b.globals.runCommand(path, args...)
+	if len(output) > 0 {
+		b.globals.log().Debug("command output", "command", path, "output", string(bytes.TrimSpace(output)))
+	}
+	return err
+}
+
+// Version returns an empty string, wlr-randr doesn't report its version.
+func (b wlrRandrBackend) Version() (string, error) {
+	return "", nil
+}